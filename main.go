@@ -1,131 +1,579 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jsafrane/vmware-check/pkg/check"
 	"github.com/jsafrane/vmware-check/pkg/clients"
+	"github.com/jsafrane/vmware-check/pkg/lint"
+	"github.com/jsafrane/vmware-check/pkg/remediation"
+	"github.com/jsafrane/vmware-check/pkg/report"
 	"github.com/jsafrane/vmware-check/pkg/vmware"
-	ocpv1 "github.com/openshift/api/config/v1"
-	"github.com/vmware/govmomi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
-	"k8s.io/legacy-cloud-providers/vsphere"
 )
 
 const (
-	configNamespace = "openshift-config"
+	// Exit codes
+	exitOK      = 0
+	exitWarning = 1
+	exitFailure = 2
+	exitError   = 3
+
+	failOnWarn = "warn"
+	failOnFail = "fail"
 )
 
 var (
-	vmwareConfig = flag.String("vmware-config", "", "Path to VMware configuration file, as used in OpenShift / Kubernetes cloud provider. It will be downloaded from OCP cluster if omitted.")
+	vmwareConfig      = flag.String("vmware-config", "", "Path to VMware configuration file, as used in OpenShift / Kubernetes cloud provider. It will be downloaded from the cluster if omitted, see -provider.")
+	installConfig     = flag.String("install-config", "", "Path to OpenShift install-config.yaml, used by 'preinstall' command.")
+	outputFormat      = flag.String("o", "", "Print report of all checks to stdout in given format: json or yaml.")
+	junitFile         = flag.String("junit", "", "Path to a JUnit XML file where to write the report of all checks.")
+	saveInventory     = flag.String("save-inventory", "", "Path to a JSON file where to save the vSphere inventory loaded by the checks, for offline inspection.")
+	loadInventory     = flag.String("load-inventory", "", "Path to a JSON file with vSphere inventory saved by -save-inventory. Checks use it instead of loading the inventory from vCenter.")
+	remediationScript = flag.String("remediation-script", "", "Path to a file where to write a script that grants all missing vCenter privileges found by the checks.")
+	remediationFormat = flag.String("remediation-format", remediation.FormatGovc, "Format of the remediation script: govc or powercli.")
+	checksFlag        = flag.String("checks", "", "Comma separated list of checks to run. All checks are run if empty. See 'list-checks' command for available checks.")
+	skipFlag          = flag.String("skip", "", "Comma separated list of checks to skip.")
+	concurrency       = flag.Int("concurrency", 4, "Maximum number of checks run in parallel. It is also the maximum number of objects (nodes, PVs, vSphere entities) a single check processes in parallel.")
+	deadline          = flag.Duration("deadline", 0, "Maximum duration of the whole run, e.g. 10m. Checks that do not finish in time are reported as failed. No limit if zero.")
+	failOn            = flag.String("fail-on", failOnFail, "Minimal severity of findings that results in non-zero exit code: warn or fail. Exit code is 0 when all checks pass, 1 when there are only warnings, 2 when at least one check failed and 3 when a check could not be performed or on error of the tool itself.")
 )
 
 func main() {
 	klog.InitFlags(nil)
+	flag.Usage = usage
 	flag.Parse()
 
-	clients, err := clients.Create()
+	command := ""
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+		// Allow flags after the command.
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			fatalf("%s", err)
+		}
+	}
+
+	switch command {
+	case "":
+		runChecks()
+	case "list-checks":
+		listChecks()
+	case "preinstall":
+		runPreinstall()
+	case "lint":
+		runLint()
+	case "show-config":
+		runShowConfig()
+	default:
+		fatalf("Unknown command %q", command)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintf(out, "Commands:\n")
+	fmt.Fprintf(out, "  lint         Check the vSphere config for deprecated, inconsistent and insecure values, without connecting to vCenter\n")
+	fmt.Fprintf(out, "  list-checks  List all available checks\n")
+	fmt.Fprintf(out, "  show-config  Print the effective vSphere config used by the checks, with passwords redacted\n")
+	fmt.Fprintf(out, "  preinstall   Run checks with vSphere configuration from -install-config, without a cluster\n")
+	fmt.Fprintf(out, "\nWithout a command, all checks are run.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// listChecks prints all available checks.
+func listChecks() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tDESCRIPTION\n")
+	for _, c := range check.Checks() {
+		fmt.Fprintf(w, "%s\t%s\n", c.Name, c.Description)
+	}
+	w.Flush()
+}
+
+// validateFlags validates flags common to all commands that run checks
+// and returns the checks to run.
+func validateFlags() []check.Check {
+	if *concurrency < 1 {
+		fatalf("Invalid -concurrency: must be at least 1")
+	}
+	if *outputFormat != "" {
+		if err := report.ValidateFormat(*outputFormat); err != nil {
+			fatalf("Invalid -o: %s", err)
+		}
+	}
+	if err := remediation.ValidateFormat(*remediationFormat); err != nil {
+		fatalf("Invalid -remediation-format: %s", err)
+	}
+	if *failOn != failOnWarn && *failOn != failOnFail {
+		fatalf("Invalid -fail-on: %q, use %q or %q", *failOn, failOnWarn, failOnFail)
+	}
+	if *loadInventory != "" && *remediationScript != "" {
+		fatalf("-remediation-script cannot be used with -load-inventory, privileges are not checked without a vCenter session")
+	}
+	checks, err := check.FilterChecks(check.Checks(), splitList(*checksFlag), splitList(*skipFlag))
 	if err != nil {
-		klog.Fatalf("Failed to create Kubernetes clients: %s", err)
+		fatalf("Invalid -checks or -skip: %s", err)
 	}
+	return checks
+}
+
+// runChecks runs all selected checks against a running cluster and exits.
+func runChecks() {
+	checks := validateFlags()
+	ctx, cancel := newContext()
+	defer cancel()
 
-	vmConfig, err := getConfig(clients)
+	kubeClient, err := clients.Create()
 	if err != nil {
-		klog.Fatalf("Failed to get VMware config: %s", err)
+		fatalf("Failed to create Kubernetes clients: %s", err)
 	}
 
-	vmClient, err := connect(clients, vmConfig)
+	provider, err := clients.NewProvider(ctx, kubeClient)
 	if err != nil {
-		klog.Fatalf("Failed to connect to vSphere: %s", err)
+		fatalf("Failed to initialize cluster provider: %s", err)
 	}
 
-	if err := check.CheckTaskPermissions(vmClient); err != nil {
-		klog.Errorf("Check failed: %s", err)
+	vmConfig, err := getConfig(ctx, provider)
+	if err != nil {
+		fatalf("Failed to get VMware config: %s", err)
 	}
-	if err := check.CheckFolderList(vmClient, vmConfig); err != nil {
-		klog.Errorf("Check failed: %s", err)
+
+	clusterID, err := provider.GetClusterID(ctx)
+	if err != nil {
+		fatalf("Failed to get cluster ID: %s", err)
 	}
-	if err := check.CheckNodes(clients, vmClient, vmConfig); err != nil {
-		klog.Errorf("Check failed: %s", err)
+
+	vCenters, vCenterErrors := connectUnlessOffline(ctx, kubeClient, vmConfig)
+
+	checkCtx := &check.CheckContext{
+		KubeClient:    kubeClient,
+		ClusterID:     clusterID,
+		VCenters:      vCenters,
+		VCenterErrors: vCenterErrors,
+		VMConfig:      vmConfig,
+		Concurrency:   *concurrency,
 	}
-	if err := check.CheckDefaultDatastore(clients, vmConfig); err != nil {
-		klog.Errorf("Check failed: %s", err)
+	runAndReport(ctx, checkCtx, checks, getClusterInfo(vmConfig, clusterID))
+}
+
+// runPreinstall runs all selected checks using vSphere configuration from
+// OpenShift install-config.yaml, without any Kubernetes API access, and exits.
+func runPreinstall() {
+	checks := validateFlags()
+	ctx, cancel := newContext()
+	defer cancel()
+	if *installConfig == "" {
+		fatalf("-install-config is required for preinstall command")
 	}
-	if err := check.CheckStorageClasses(clients, vmClient, vmConfig); err != nil {
-		klog.Errorf("Check failed: %s", err)
+
+	data, err := ioutil.ReadFile(*installConfig)
+	if err != nil {
+		fatalf("Failed to read install config: %s", err)
+	}
+	ic, err := vmware.ParseInstallConfig(data)
+	if err != nil {
+		fatalf("Failed to parse install config %s: %s", *installConfig, err)
 	}
-	if err := check.CheckPVs(clients, vmClient, vmConfig); err != nil {
-		klog.Errorf("Check failed: %s", err)
+	vmConfig := ic.VSphereConfig()
+	clusterID := ic.ClusterID()
+	klog.V(2).Infof("Using synthetic cluster ID %s", clusterID)
+
+	vCenters, vCenterErrors := connectUnlessOffline(ctx, nil, vmConfig)
+
+	checkCtx := &check.CheckContext{
+		ClusterID:     clusterID,
+		VCenters:      vCenters,
+		VCenterErrors: vCenterErrors,
+		VMConfig:      vmConfig,
+		Concurrency:   *concurrency,
 	}
+	runAndReport(ctx, checkCtx, checks, getClusterInfo(vmConfig, clusterID))
 }
 
-func connect(clients clients.Interface, cfg *vsphere.VSphereConfig) (*govmomi.Client, error) {
-	secret, err := clients.GetSecret(cfg.Global.SecretNamespace, cfg.Global.SecretName)
+// runLint checks the VMware config from -vmware-config or from the cluster,
+// without connecting to vCenter, and exits.
+func runLint() {
+	if *outputFormat != "" {
+		if err := report.ValidateFormat(*outputFormat); err != nil {
+			fatalf("Invalid -o: %s", err)
+		}
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+	cloudConfig := getConfigDataWithoutChecks(ctx)
+	vmConfig, err := parseConfig(cloudConfig)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get cluster secret %s/%s: %s", cfg.Global.SecretNamespace, cfg.Global.SecretName, err)
+		fatalf("%s", err)
+	}
+
+	c := check.Check{
+		Name:        "lint",
+		Description: fmt.Sprintf("Checks vSphere config from %s", cloudConfig.Source),
 	}
-	klog.V(4).Infof("Got Secret %s/%s", cfg.Global.SecretNamespace, cfg.Global.SecretName)
+	opts := lint.Options{
+		// A local file may be a copy of anything, do not guess where it came from.
+		InConfigMap: *vmwareConfig == "" && !cloudConfig.InSecret,
+	}
+	rep := report.NewReport(getClusterInfo(vmConfig, ""))
+	start := time.Now()
+	result := lint.Lint(vmConfig, opts)
+	rep.AddResult(c, result, start, time.Since(start))
+	logResult(c, result)
+	writeReports(rep, nil)
+}
 
-	userKey := cfg.Workspace.VCenterIP + "." + "username"
-	username := string(secret.Data[userKey])
-	passwordKey := cfg.Workspace.VCenterIP + "." + "password"
-	password := string(secret.Data[passwordKey])
-	vmClient, err := vmware.NewClient(cfg, username, password)
+// runShowConfig prints the effective VMware config from -vmware-config or
+// from the cluster, without connecting to vCenter, and exits.
+func runShowConfig() {
+	format := *outputFormat
+	if format == "" {
+		format = report.FormatYAML
+	}
+	if err := report.ValidateFormat(format); err != nil {
+		fatalf("Invalid -o: %s", err)
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+	cloudConfig := getConfigDataWithoutChecks(ctx)
+	vmConfig, configFormat, err := vmware.ParseConfigWithFormat(cloudConfig.Data)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to connect to %s: %s", cfg.Workspace.VCenterIP, err)
+		fatalf("Failed to parse config from %s: %s", cloudConfig.Source, err)
+	}
+	eff := vmware.GetEffectiveConfig(vmConfig)
+	eff.Source = cloudConfig.Source
+	eff.Format = configFormat
+	if err := report.WriteObject(os.Stdout, format, eff); err != nil {
+		fatalf("Failed to write config: %s", err)
 	}
-	klog.V(2).Infof("Connected to %s as %s", cfg.Workspace.VCenterIP, username)
-	return vmClient, nil
+	klog.Flush()
+	os.Exit(exitOK)
 }
 
-func getConfig(clients clients.Interface) (*vsphere.VSphereConfig, error) {
-	var cfgData string
+// getConfigDataWithoutChecks returns the VMware config for commands that do
+// not run any checks. Kubernetes clients are created only when the config
+// is read from the cluster.
+func getConfigDataWithoutChecks(ctx context.Context) *clients.CloudConfig {
+	var provider clients.Provider
 	if *vmwareConfig == "" {
-		var err error
-		klog.V(4).Infof("Trying to get VMware config from the cluster")
-		cfg, err := getConfigDataFromCluster(clients)
+		kubeClient, err := clients.Create()
 		if err != nil {
-			return nil, err
+			fatalf("Failed to create Kubernetes clients: %s", err)
 		}
-		cfgData = cfg
-	} else {
-		var err error
-		klog.V(4).Infof("Loading VMware config from %s", *vmwareConfig)
-		cfg, err := ioutil.ReadFile(*vmwareConfig)
+		provider, err = clients.NewProvider(ctx, kubeClient)
 		if err != nil {
-			return nil, err
+			fatalf("Failed to initialize cluster provider: %s", err)
+		}
+	}
+	cloudConfig, err := getConfigData(ctx, provider)
+	if err != nil {
+		fatalf("Failed to get VMware config: %s", err)
+	}
+	return cloudConfig
+}
+
+// newContext returns the root context of the run, which expires after -deadline.
+func newContext() (context.Context, context.CancelFunc) {
+	if *deadline > 0 {
+		return context.WithTimeout(context.Background(), *deadline)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// runAndReport runs the checks, writes all reports and exits.
+// Up to -concurrency checks run in parallel, results are reported in the
+// order of the checks. The vSphere inventory is loaded by the first check
+// that needs it, or read from -load-inventory.
+func runAndReport(ctx context.Context, checkCtx *check.CheckContext, checks []check.Check, info report.ClusterInfo) {
+	if *loadInventory != "" {
+		inv, err := vmware.ReadInventory(*loadInventory)
+		if err != nil {
+			fatalf("Failed to read vSphere inventory: %s", err)
+		}
+		checkCtx.Inventory = inv
+	}
+
+	results := make([]*check.Result, len(checks))
+	starts := make([]time.Time, len(checks))
+	durations := make([]time.Duration, len(checks))
+	workqueue.ParallelizeUntil(ctx, *concurrency, len(checks), func(i int) {
+		starts[i] = time.Now()
+		results[i] = check.RunCheck(ctx, checkCtx, checks[i])
+		durations[i] = time.Since(starts[i])
+	})
+
+	rep := report.NewReport(info)
+	for i, c := range checks {
+		result := results[i]
+		if result == nil {
+			// The deadline expired before the check was started.
+			starts[i] = time.Now()
+			result = check.NewResult()
+			result.Add(check.Finding{
+				Severity: check.StatusError,
+				Message:  fmt.Sprintf("check not run: %s", ctx.Err()),
+				Fix:      "Increase -deadline",
+			})
+		}
+		rep.AddResult(c, result, starts[i], durations[i])
+		logResult(c, result)
+	}
+	if *saveInventory != "" {
+		// Loads the inventory when no check needed it.
+		inv, err := checkCtx.GetInventory(ctx)
+		if err != nil {
+			fatalf("Failed to save vSphere inventory: %s", err)
+		}
+		if err := inv.Save(*saveInventory); err != nil {
+			fatalf("Failed to save vSphere inventory: %s", err)
+		}
+	}
+	writeReports(rep, checkCtx)
+}
+
+// writeReports writes the report in all requested formats and exits.
+// The remediation script is written only when checkCtx is not nil.
+func writeReports(rep *report.Report, checkCtx *check.CheckContext) {
+	if *outputFormat != "" {
+		if err := rep.Write(os.Stdout, *outputFormat); err != nil {
+			fatalf("Failed to write report: %s", err)
+		}
+	}
+	if *junitFile != "" {
+		if err := writeJUnit(rep, *junitFile); err != nil {
+			fatalf("Failed to write JUnit report: %s", err)
 		}
-		cfgData = string(cfg)
 	}
+	if *remediationScript != "" && checkCtx != nil {
+		if err := writeRemediationScript(rep, checkCtx, *remediationScript); err != nil {
+			fatalf("Failed to write remediation script: %s", err)
+		}
+	}
+
+	klog.Flush()
+	os.Exit(exitCode(rep.Status()))
+}
 
-	cfg, err := vmware.ParseConfig(cfgData)
+func writeRemediationScript(rep *report.Report, checkCtx *check.CheckContext, path string) error {
+	vc := checkCtx.DefaultVCenter()
+	if vc == nil {
+		return fmt.Errorf("the default vCenter %s is not connected", checkCtx.VMConfig.Workspace.VCenterIP)
+	}
+	opts := remediation.Options{
+		Principal:  vc.Username,
+		Datacenter: checkCtx.VMConfig.Workspace.Datacenter,
+	}
+	f, err := os.Create(path)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse config: %s", err)
+		return err
 	}
-	return cfg, nil
+	if err := remediation.Write(f, *remediationFormat, rep, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
-func getConfigDataFromCluster(clients clients.Interface) (string, error) {
-	infra, err := clients.GetInfrastructure()
+// splitList splits comma separated list of values.
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// exitCode returns exit code of the tool for given overall status of all checks.
+func exitCode(status check.Status) int {
+	switch status {
+	case check.StatusError:
+		return exitError
+	case check.StatusFail:
+		return exitFailure
+	case check.StatusWarn:
+		if *failOn == failOnWarn {
+			return exitWarning
+		}
+	}
+	return exitOK
+}
+
+// fatalf logs the error and exits with exitError.
+func fatalf(format string, args ...interface{}) {
+	klog.ErrorDepth(1, fmt.Sprintf(format, args...))
+	klog.Flush()
+	os.Exit(exitError)
+}
+
+func writeJUnit(rep *report.Report, path string) error {
+	f, err := os.Create(path)
 	if err != nil {
-		klog.Fatalf("Failed to get Infrastructure: %s", err)
+		return err
 	}
-	klog.V(4).Infof("Got Infrastructure with Platform %q", infra.Status.PlatformStatus.Type)
+	if err := rep.WriteJUnit(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	if infra.Status.PlatformStatus.Type != ocpv1.VSpherePlatformType {
-		klog.Fatalf("Unsupported platform: %s", infra.Status.PlatformStatus.Type)
+func getClusterInfo(cfg *vmware.Config, clusterID string) report.ClusterInfo {
+	info := report.ClusterInfo{
+		InfrastructureName: clusterID,
+		VCenter:            cfg.Workspace.VCenterIP,
 	}
+	for _, vc := range vmware.GetVCenters(cfg) {
+		info.VCenters = append(info.VCenters, vc.Server)
+	}
+	return info
+}
+
+func logResult(c check.Check, result *check.Result) {
+	for _, f := range result.Findings {
+		msg := f.Message
+		if f.Object.Kind != "" {
+			msg = fmt.Sprintf("%s: %s", f.Object, f.Message)
+		}
+		if f.Fix != "" {
+			msg = fmt.Sprintf("%s (fix: %s)", msg, f.Fix)
+		}
+		switch f.Severity {
+		case check.StatusInfo:
+			klog.V(2).Infof("Check %q: %s", c.Name, msg)
+		case check.StatusWarn:
+			klog.Warningf("Check %q: %s", c.Name, msg)
+		default:
+			klog.Errorf("Check %q: %s", c.Name, msg)
+		}
+	}
+	if result.Message != "" {
+		klog.Infof("Check %q: %s, %s", c.Name, result.Status, result.Message)
+	} else {
+		klog.Infof("Check %q: %s", c.Name, result.Status)
+	}
+}
 
-	configMap, err := clients.GetConfigMap(configNamespace, infra.Spec.CloudConfig.Name)
+// connectUnlessOffline connects to all vCenters in the config. With
+// -load-inventory, the checks run without a vCenter session and it returns
+// no vCenters. Checks that need a session are then skipped.
+func connectUnlessOffline(ctx context.Context, clients clients.Interface, cfg *vmware.Config) ([]*vmware.VCenter, map[string]error) {
+	if *loadInventory != "" {
+		klog.V(2).Infof("Using inventory from %s, not connecting to vSphere", *loadInventory)
+		return nil, nil
+	}
+	return connect(ctx, clients, cfg)
+}
+
+// connect opens a session to all vCenters in the config. Credentials are
+// read from the cluster secret, or from the config when it has no secret.
+// A vCenter that cannot be connected does not stop the run, its error is
+// returned by server and checks report it.
+func connect(ctx context.Context, clients clients.Interface, cfg *vmware.Config) ([]*vmware.VCenter, map[string]error) {
+	// Secrets by <namespace>/<name>, vCenters usually share one.
+	secrets := map[string]*v1.Secret{}
+
+	var vCenters []*vmware.VCenter
+	errs := map[string]error{}
+	for _, vcConfig := range vmware.GetVCenters(cfg) {
+		vc, err := connectVCenter(ctx, clients, vcConfig, secrets)
+		if err != nil {
+			klog.Errorf("Failed to connect to vCenter %s: %s", vcConfig.Server, err)
+			errs[vcConfig.Server] = err
+			continue
+		}
+		klog.V(2).Infof("Connected to %s as %s", vcConfig.Server, vc.Username)
+		vCenters = append(vCenters, vc)
+	}
+	return vCenters, errs
+}
+
+// connectVCenter opens a session to a single vCenter. Secrets that were
+// already read are cached in secrets.
+func connectVCenter(ctx context.Context, clients clients.Interface, vcConfig *vmware.VCenterConfig, secrets map[string]*v1.Secret) (*vmware.VCenter, error) {
+	username := vcConfig.User
+	password := vcConfig.Password
+	if vcConfig.SecretName != "" {
+		secretName := vcConfig.SecretNamespace + "/" + vcConfig.SecretName
+		secret, found := secrets[secretName]
+		if !found {
+			var err error
+			secret, err = clients.GetSecret(ctx, vcConfig.SecretNamespace, vcConfig.SecretName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cluster secret %s: %s", secretName, err)
+			}
+			klog.V(4).Infof("Got Secret %s", secretName)
+			secrets[secretName] = secret
+		}
+		var err error
+		if username, err = getSecretKey(secret, secretName, vcConfig.Server+".username"); err != nil {
+			return nil, err
+		}
+		if password, err = getSecretKey(secret, secretName, vcConfig.Server+".password"); err != nil {
+			return nil, err
+		}
+	}
+	vmClient, err := vmware.NewClient(ctx, vcConfig, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &vmware.VCenter{
+		Config:   vcConfig,
+		Client:   vmClient,
+		Username: username,
+	}, nil
+}
+
+// getSecretKey returns value of the key in the secret. It returns error when
+// the key is missing or empty, the vCenter login would fail anyway.
+func getSecretKey(secret *v1.Secret, secretName, key string) (string, error) {
+	value := secret.Data[key]
+	if len(value) == 0 {
+		return "", fmt.Errorf("Secret %s does not contain key %s", secretName, key)
+	}
+	return string(value), nil
+}
+
+func getConfig(ctx context.Context, provider clients.Provider) (*vmware.Config, error) {
+	cloudConfig, err := getConfigData(ctx, provider)
 	if err != nil {
-		return "", fmt.Errorf("Failed to get cluster config: %s", err)
+		return nil, err
 	}
-	cfgString, found := configMap.Data[infra.Spec.CloudConfig.Key]
-	if !found {
-		return "", fmt.Errorf("Cluster config %s/%s does not contain key %s", configNamespace, infra.Spec.CloudConfig.Name, infra.Spec.CloudConfig.Key)
+	return parseConfig(cloudConfig)
+}
+
+// getConfigData returns content of -vmware-config file or the config from the cluster.
+// The provider may be nil when -vmware-config is set.
+func getConfigData(ctx context.Context, provider clients.Provider) (*clients.CloudConfig, error) {
+	if *vmwareConfig != "" {
+		klog.V(4).Infof("Loading VMware config from %s", *vmwareConfig)
+		data, err := ioutil.ReadFile(*vmwareConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &clients.CloudConfig{Data: string(data), Source: "file " + *vmwareConfig}, nil
+	}
+	klog.V(4).Infof("Trying to get VMware config from %s cluster", provider.Name())
+	return provider.GetCloudConfig(ctx)
+}
+
+func parseConfig(cloudConfig *clients.CloudConfig) (*vmware.Config, error) {
+	cfg, err := vmware.ParseConfig(cloudConfig.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse config from %s: %s", cloudConfig.Source, err)
 	}
-	klog.V(4).Infof("Got ConfigMap %s/%s with config:\n%s", configNamespace, infra.Spec.CloudConfig.Name, cfgString)
-	return cfgString, nil
+	return cfg, nil
 }
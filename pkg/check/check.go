@@ -0,0 +1,303 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jsafrane/vmware-check/pkg/clients"
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// CheckContext is the shared state passed to all checks.
+type CheckContext struct {
+	// Kubernetes / OpenShift API clients. Nil when the checks run
+	// without a cluster, e.g. before installation.
+	KubeClient clients.Interface
+	// ClusterID is ID of the cluster, as used in names of volumes.
+	ClusterID string
+	// Connections to all configured vCenters. Empty when the inventory is
+	// read from a file and the checks run without a vCenter session.
+	VCenters []*vmware.VCenter
+	// VCenterErrors are errors of vCenters that could not be connected,
+	// by server. They are not in VCenters.
+	VCenterErrors map[string]error
+	// Parsed vSphere cloud provider configuration.
+	VMConfig *vmware.Config
+	// Inventory of all configured datacenters, shared by all checks.
+	// When nil, it's loaded by the first check that needs it, see GetInventory.
+	Inventory *vmware.Inventory
+	// Concurrency is the maximum number of objects (nodes, PVs, entities)
+	// a check processes in parallel.
+	Concurrency int
+
+	inventoryErr  error
+	inventoryOnce sync.Once
+
+	// vms is index of all VMs in the inventory, built by the first check that needs it.
+	vms     *vmIndex
+	vmsErr  error
+	vmsOnce sync.Once
+
+	// entities used by the cluster in the default vCenter, resolved by
+	// the first check that needs them. entityFindings are findings about
+	// entities that could not be found.
+	entities       []entity
+	entityFindings []Finding
+	entitiesOnce   sync.Once
+}
+
+// GetInventory returns inventory of all configured datacenters. It's loaded
+// on the first call and shared by all checks.
+func (c *CheckContext) GetInventory(ctx context.Context) (*vmware.Inventory, error) {
+	c.inventoryOnce.Do(func() {
+		if c.Inventory != nil {
+			return
+		}
+		c.Inventory, c.inventoryErr = vmware.LoadInventory(ctx, c.VCenters)
+		if c.inventoryErr != nil {
+			c.inventoryErr = fmt.Errorf("failed to load vSphere inventory: %s", c.inventoryErr)
+		}
+	})
+	return c.Inventory, c.inventoryErr
+}
+
+// DefaultVCenter returns connection to the vCenter from the Workspace section,
+// i.e. the one where volumes are provisioned. It returns nil when the vCenter
+// is not connected, checks that call it must check hasVCenterSession first.
+func (c *CheckContext) DefaultVCenter() *vmware.VCenter {
+	for _, vc := range c.VCenters {
+		if vc.Config.Server == c.VMConfig.Workspace.VCenterIP {
+			return vc
+		}
+	}
+	if _, failed := c.VCenterErrors[c.VMConfig.Workspace.VCenterIP]; failed || len(c.VCenters) == 0 {
+		return nil
+	}
+	return c.VCenters[0]
+}
+
+// hasVCenterSession returns true when the default vCenter is connected.
+func (c *CheckContext) hasVCenterSession() bool {
+	return c.DefaultVCenter() != nil
+}
+
+// noVCenterResult returns result of a check that needs the default vCenter
+// session when it is not connected. The check is skipped without any
+// session and fails with StatusError when the vCenter could not be connected.
+func (c *CheckContext) noVCenterResult() *Result {
+	if len(c.VCenterErrors) == 0 {
+		return SkippedResult(noVCenterReason)
+	}
+	result := NewResult()
+	c.addVCenterErrors(result)
+	return result
+}
+
+// addVCenterErrors reports each vCenter that could not be connected as a
+// finding with StatusError. Checks that use vCenter sessions or the
+// inventory call it, they check only the connected vCenters.
+func (c *CheckContext) addVCenterErrors(result *Result) {
+	var servers []string
+	for server := range c.VCenterErrors {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		result.add(StatusError, Object{Kind: KindVCenter, Name: server}, fmt.Sprintf("vCenter not checked, failed to connect: %s", c.VCenterErrors[server]), "Make sure the vCenter is reachable and the vCenter user credentials are valid")
+	}
+}
+
+// defaultServer returns server of the default vCenter, also when there is
+// no vCenter session.
+func (c *CheckContext) defaultServer() string {
+	if !c.hasVCenterSession() {
+		return c.VMConfig.Workspace.VCenterIP
+	}
+	return c.DefaultVCenter().Config.Server
+}
+
+// getVCenter returns connection to the vCenter with given server or nil when
+// the vCenter is not connected.
+func (c *CheckContext) getVCenter(server string) *vmware.VCenter {
+	for _, vc := range c.VCenters {
+		if vc.Config.Server == server {
+			return vc
+		}
+	}
+	return nil
+}
+
+// vSphereObject returns Object of a vSphere entity in the vCenter. Objects in
+// the default vCenter do not have VCenter set.
+func (c *CheckContext) vSphereObject(vc *vmware.VCenter, kind ObjectKind, name string) Object {
+	object := Object{Kind: kind, Name: name}
+	if vc != c.DefaultVCenter() {
+		object.VCenter = vc.Config.Server
+	}
+	return object
+}
+
+// parallelize calls work for each of n pieces, with at most Concurrency
+// pieces processed at the same time. It returns error when the context
+// expires before all pieces are processed.
+func (c *CheckContext) parallelize(ctx context.Context, n int, work func(i int)) error {
+	workers := c.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	workqueue.ParallelizeUntil(ctx, workers, n, work)
+	return ctx.Err()
+}
+
+// parallelizeResults calls work for each of n pieces like parallelize. Each
+// piece gets its own Result and the results are merged in the order of the
+// pieces, so findings do not depend on which piece finished first.
+func (c *CheckContext) parallelizeResults(ctx context.Context, n int, work func(i int, result *Result)) (*Result, error) {
+	results := make([]*Result, n)
+	err := c.parallelize(ctx, n, func(i int) {
+		results[i] = NewResult()
+		work(i, results[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := NewResult()
+	for _, r := range results {
+		result.Merge(r)
+	}
+	return result, nil
+}
+
+// checkNodes calls check for each node in the cluster, see parallelizeResults.
+func (c *CheckContext) checkNodes(ctx context.Context, check func(vms *vmIndex, node *v1.Node, result *Result)) (*Result, error) {
+	nodes, err := c.KubeClient.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vms, err := c.getVMIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.parallelizeResults(ctx, len(nodes), func(i int, result *Result) {
+		check(vms, &nodes[i], result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.addVCenterErrors(result)
+	result.Message = fmt.Sprintf("%d nodes checked", len(nodes))
+	return result, nil
+}
+
+const (
+	noKubernetesReason = "Kubernetes API is not available"
+	noVCenterReason    = "no vCenter session, the inventory was read from a file"
+)
+
+// CheckFunc is the function that performs a single check. It returns error
+// when the check itself could not be performed, e.g. when an API call fails.
+// Issues found by the check are reported as findings in the Result.
+// Checks may run in parallel, they must not modify the CheckContext.
+type CheckFunc func(ctx context.Context, checkCtx *CheckContext) (*Result, error)
+
+// Check is a single registered check.
+type Check struct {
+	// Name is a short, stable identifier of the check, e.g. "nodes".
+	Name string
+	// Description is a human readable description of what the check verifies.
+	Description string
+	// Run performs the check.
+	Run CheckFunc
+}
+
+var (
+	registry []Check
+)
+
+func init() {
+	Register("tasks", "vCenter user can list tasks", CheckTaskPermissions)
+	Register("folder", "vCenter user can list files in the default datastore", CheckFolderList)
+	Register("nodes", "Nodes have providerID and their VMs have disk.enableUUID and hardware version supported by the CSI driver", CheckNodes)
+	Register("vmware-tools", "VMware Tools run and are up to date in VMs of all nodes and report the node's hostname", CheckVMwareTools)
+	Register("default-datastore", "Name of the default datastore is short enough", CheckDefaultDatastore)
+	Register("storageclasses", "Datastores in vSphere StorageClasses have short enough names and exist", CheckStorageClasses)
+	Register("pvs", "Volume paths of existing vSphere PVs are short enough", CheckPVs)
+	Register("privileges", "vCenter user has all privileges OpenShift needs on all vSphere entities used by the cluster", CheckPrivileges)
+	Register("permissions", "Roles and entities that grant permissions of the vCenter user", CheckPermissions)
+	Register("network", "Network of the VMs exists", CheckNetwork)
+	Register("config-drift", "Copies of the cloud config rendered by OpenShift operators match the cloud config", CheckConfigDrift)
+	Register("excess-privileges", "vCenter user does not have more privileges than OpenShift needs", CheckExcessPrivileges)
+}
+
+// Register adds a new check to the list of checks that are run.
+// Checks are run in the order of registration. It panics when a check
+// with the same name is already registered.
+func Register(name, description string, run CheckFunc) {
+	for _, c := range registry {
+		if c.Name == name {
+			panic(fmt.Sprintf("check %q is already registered", name))
+		}
+	}
+	registry = append(registry, Check{
+		Name:        name,
+		Description: description,
+		Run:         run,
+	})
+}
+
+// Checks returns all registered checks in the order of registration.
+func Checks() []Check {
+	checks := make([]Check, len(registry))
+	copy(checks, registry)
+	return checks
+}
+
+// RunCheck runs a single check and returns its result. Error returned by the
+// check is reported as a finding with StatusError, so it's not confused with
+// issues found by the check.
+func RunCheck(ctx context.Context, checkCtx *CheckContext, c Check) *Result {
+	klog.V(4).Infof("Running check %q", c.Name)
+	result, err := c.Run(ctx, checkCtx)
+	if err != nil {
+		if result == nil {
+			result = NewResult()
+		}
+		result.add(StatusError, Object{}, fmt.Sprintf("check failed: %s", err), "")
+	}
+	return result
+}
+
+// FilterChecks returns checks whose names are listed in names (or all checks
+// when names is empty) and which are not listed in skip. The original order
+// of the checks is preserved. It returns error when a name does not match
+// any check.
+func FilterChecks(checks []Check, names, skip []string) ([]Check, error) {
+	known := sets.NewString()
+	for _, c := range checks {
+		known.Insert(c.Name)
+	}
+	include := sets.NewString(names...)
+	exclude := sets.NewString(skip...)
+	if unknown := include.Union(exclude).Difference(known); unknown.Len() > 0 {
+		return nil, fmt.Errorf("unknown checks: %s", strings.Join(unknown.List(), ", "))
+	}
+
+	var filtered []Check
+	for _, c := range checks {
+		if include.Len() > 0 && !include.Has(c.Name) {
+			continue
+		}
+		if exclude.Has(c.Name) {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered, nil
+}
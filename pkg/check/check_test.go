@@ -0,0 +1,109 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+)
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		run            CheckFunc
+		expectedStatus Status
+	}{
+		{
+			name: "check with failed finding",
+			run: func(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+				result := NewResult()
+				result.Fail(Object{Kind: KindNode, Name: "node-0"}, "providerID is empty", "")
+				return result, nil
+			},
+			expectedStatus: StatusFail,
+		},
+		{
+			name: "check returning error",
+			run: func(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+				return nil, errors.New("connection refused")
+			},
+			expectedStatus: StatusError,
+		},
+		{
+			name: "check returning error with partial result",
+			run: func(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+				result := NewResult()
+				result.Fail(Object{Kind: KindNode, Name: "node-0"}, "providerID is empty", "")
+				return result, context.DeadlineExceeded
+			},
+			expectedStatus: StatusError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := RunCheck(context.Background(), &CheckContext{}, Check{Name: "test", Run: test.run})
+			if result.Status != test.expectedStatus {
+				t.Errorf("expected status %s, got %s", test.expectedStatus, result.Status)
+			}
+		})
+	}
+}
+
+func TestChecksWithoutVCenterSession(t *testing.T) {
+	checkCtx := &CheckContext{
+		VMConfig: &vmware.Config{},
+	}
+	checkCtx.VMConfig.Workspace.DefaultDatastore = "datastore1"
+	tests := []struct {
+		name string
+		run  CheckFunc
+	}{
+		{name: "tasks", run: CheckTaskPermissions},
+		{name: "folder", run: CheckFolderList},
+		{name: "privileges", run: CheckPrivileges},
+		{name: "permissions", run: CheckPermissions},
+		{name: "excess-privileges", run: CheckExcessPrivileges},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := RunCheck(context.Background(), checkCtx, Check{Name: test.name, Run: test.run})
+			if result.Status != StatusSkip {
+				t.Errorf("expected status %s, got %s: %+v", StatusSkip, result.Status, result.Findings)
+			}
+		})
+	}
+}
+
+func TestChecksWithFailedDefaultVCenter(t *testing.T) {
+	checkCtx := &CheckContext{
+		VMConfig:      &vmware.Config{},
+		VCenterErrors: map[string]error{"vcenter.example.com": errors.New("connection refused")},
+	}
+	checkCtx.VMConfig.Workspace.VCenterIP = "vcenter.example.com"
+	checkCtx.VMConfig.Workspace.DefaultDatastore = "datastore1"
+	tests := []struct {
+		name string
+		run  CheckFunc
+	}{
+		{name: "tasks", run: CheckTaskPermissions},
+		{name: "folder", run: CheckFolderList},
+		{name: "privileges", run: CheckPrivileges},
+		{name: "permissions", run: CheckPermissions},
+		{name: "excess-privileges", run: CheckExcessPrivileges},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := RunCheck(context.Background(), checkCtx, Check{Name: test.name, Run: test.run})
+			if result.Status != StatusError {
+				t.Errorf("expected status %s, got %s: %+v", StatusError, result.Status, result.Findings)
+			}
+			if len(result.Findings) != 1 || result.Findings[0].Object != (Object{Kind: KindVCenter, Name: "vcenter.example.com"}) {
+				t.Errorf("expected one finding of the vCenter, got %+v", result.Findings)
+			}
+		})
+	}
+}
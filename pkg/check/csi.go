@@ -0,0 +1,78 @@
+package check
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	"k8s.io/klog/v2"
+)
+
+const (
+	csiDriverName = "csi.vsphere.vmware.com"
+
+	// Sample pod UID used to check paths of volumes in pods that do not exist yet.
+	samplePodUID = "5137595f-7ce3-e95a-5c03-06d835dea807"
+
+	// Path where a CSI volume is published to a pod, with pod UID and PV name.
+	csiPublishPathFormat = "/var/lib/kubelet/pods/%s/volumes/kubernetes.io~csi/%s/mount"
+	// Global mount path used by older kubelets, with PV name.
+	csiGlobalMountPathFormat = "/var/lib/kubelet/plugins/kubernetes.io/csi/pv/%s/globalmount"
+	// Global mount path used by newer kubelets, with driver name and sha256 of the volume handle.
+	csiHashedGlobalMountPathFormat = "/var/lib/kubelet/plugins/kubernetes.io/csi/%s/%x/globalmount"
+)
+
+// checkCSIStorageClass checks that the datastore and the storage policy of
+// a CSI storage class exist. The storage class does not affect paths of
+// volumes, they depend only on PV names and volume handles.
+func checkCSIStorageClass(ctx context.Context, parameters map[string]string, checkCtx *CheckContext, object Object, result *Result) {
+	for k, v := range parameters {
+		switch strings.ToLower(k) {
+		case dsURLParameter:
+			inv, err := checkCtx.GetInventory(ctx)
+			if err != nil {
+				result.Fail(object, err.Error(), "")
+				continue
+			}
+			checkDatastoreURL(v, inv, object, result)
+		case storagePolicyParameter:
+			dataStores, ok := getStoragePolicyDatastores(ctx, v, checkCtx, object, result)
+			if ok && len(dataStores) == 0 {
+				result.Fail(object, fmt.Sprintf("storage policy %q is not compatible with any datastore in the configured datacenters", v), "Make sure the storage policy matches at least one datastore available to the cluster")
+			}
+		}
+	}
+}
+
+// checkDatastoreURL checks that a datastore with given URL exists in at
+// least one configured datacenter.
+func checkDatastoreURL(url string, inv *vmware.Inventory, object Object, result *Result) {
+	for _, dc := range inv.Datacenters {
+		for i := range dc.Datastores {
+			if dc.Datastores[i].URL == url {
+				klog.V(4).Infof("Datastore with URL %q found in %s: %s", url, dc.String(), dc.Datastores[i].Name)
+				return
+			}
+		}
+	}
+	result.Fail(object, fmt.Sprintf("datastore with URL %q not found in any configured datacenter", url), "Use URL of a datastore that exists in a datacenter listed in the cloud provider config")
+}
+
+// checkCSIVolumeName checks that all paths kubelet uses to mount a CSI volume
+// are short enough.
+func checkCSIVolumeName(pvName, volumeHandle string) error {
+	paths := []string{
+		fmt.Sprintf(csiGlobalMountPathFormat, pvName),
+		fmt.Sprintf(csiHashedGlobalMountPathFormat, csiDriverName, sha256.Sum256([]byte(volumeHandle))),
+		fmt.Sprintf(csiPublishPathFormat, samplePodUID, pvName),
+	}
+	for _, path := range paths {
+		klog.V(4).Infof("Checking CSI volume path %s", path)
+		if err := checkMountPath(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
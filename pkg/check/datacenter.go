@@ -0,0 +1,23 @@
+package check
+
+import (
+	"path"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+)
+
+// findDatastore returns all datacenters in the inventory that contain datastore
+// with given name. The name may be also an inventory path of the datastore.
+func findDatastore(inv *vmware.Inventory, dsName string) []*vmware.InventoryDatacenter {
+	var found []*vmware.InventoryDatacenter
+	name := path.Base(dsName)
+	for _, dc := range inv.Datacenters {
+		for i := range dc.Datastores {
+			if dc.Datastores[i].Name == name {
+				found = append(found, dc)
+				break
+			}
+		}
+	}
+	return found
+}
@@ -3,45 +3,54 @@ package check
 import (
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
+	"sync"
 
-	"github.com/jsafrane/vmware-check/pkg/clients"
+	"github.com/jsafrane/vmware-check/pkg/systemd"
 	"github.com/jsafrane/vmware-check/pkg/vmware"
-	configv1 "github.com/openshift/api/config/v1"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/pbm"
 	"github.com/vmware/govmomi/pbm/types"
-	"github.com/vmware/govmomi/view"
-	vim "github.com/vmware/govmomi/vim25/types"
-	"k8s.io/apimachinery/pkg/util/errors"
-	"k8s.io/apimachinery/pkg/util/sets"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
-	"k8s.io/legacy-cloud-providers/vsphere"
 )
 
 const (
+	inTreeProvisioner = "kubernetes.io/vsphere-volume"
+
 	dsParameter            = "datastore"
 	storagePolicyParameter = "storagepolicyname"
+	// dsURLParameter is the datastore parameter of CSI storage classes.
+	dsURLParameter = "datastoreurl"
+
+	datastoreNameFix = "Rename the datastore to a shorter name or use a different datastore"
+	csiVolumeNameFix = "Use a shorter PV name, kubelet cannot mount volumes with too long paths"
 )
 
 // CheckStorageClasses tests that datastore name in storage classes is short enough.
-func CheckStorageClasses(clients clients.Interface, vmClient *govmomi.Client, config *vsphere.VSphereConfig) error {
-	var errs []error
+// Paths of CSI volumes do not depend on the datastore, so for CSI storage
+// classes it checks only that their datastore and storage policy exist.
+func CheckStorageClasses(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
 	klog.V(4).Infof("CheckStorageClasses started")
-
-	infra, err := clients.GetInfrastructure()
-	if err != nil {
-		return err
+	if checkCtx.KubeClient == nil {
+		return SkippedResult(noKubernetesReason), nil
 	}
 
-	scs, err := clients.ListStorageClasses()
+	scs, err := checkCtx.KubeClient.ListStorageClasses(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
 	for i := range scs {
 		sc := &scs[i]
-		if sc.Provisioner != "kubernetes.io/vsphere-volume" {
+		object := Object{Kind: KindStorageClass, Name: sc.Name}
+		if sc.Provisioner == csiDriverName {
+			klog.V(4).Infof("Checking CSI storage class %q", sc.Name)
+			checkCSIStorageClass(ctx, sc.Parameters, checkCtx, object, result)
+			continue
+		}
+		if sc.Provisioner != inTreeProvisioner {
 			klog.V(4).Infof("Skipping storage class %q: not a vSphere class", sc.Name)
 			continue
 		}
@@ -49,128 +58,157 @@ func CheckStorageClasses(clients clients.Interface, vmClient *govmomi.Client, co
 		for k, v := range sc.Parameters {
 			switch strings.ToLower(k) {
 			case dsParameter:
-				if err := checkDataStore(v, infra); err != nil {
-					errs = append(errs, fmt.Errorf("StorageClass %q is invalid: %s", sc.Name, err))
+				if err := checkDataStore(v, checkCtx.ClusterID); err != nil {
+					result.Fail(object, err.Error(), datastoreNameFix)
 				}
-			case storagePolicyParameter:
-				if err := checkStoragePolicy(v, infra, vmClient); err != nil {
-					errs = append(errs, fmt.Errorf("StorageClass %q is invalid: %s", sc.Name, err))
+				inv, err := checkCtx.GetInventory(ctx)
+				if err != nil {
+					result.Fail(object, err.Error(), "")
+					continue
 				}
+				checkDatastoreExists(v, inv, object, result)
+			case storagePolicyParameter:
+				checkStoragePolicy(ctx, v, checkCtx, object, result)
 			default:
 				klog.V(4).Infof("Skipping storage class %q, it does not have %s nor %s parameter", sc.Name, dsParameter, storagePolicyParameter)
 			}
 		}
 	}
-	if len(errs) != 0 {
-		return errors.NewAggregate(errs)
-	}
-	klog.V(4).Infof("CheckStorageClasses succeeded, %d storage classes checked", len(scs))
-	return nil
+	result.Message = fmt.Sprintf("%d storage classes checked", len(scs))
+	klog.V(4).Infof("CheckStorageClasses finished, %d storage classes checked", len(scs))
+	return result, nil
 }
 
 // CheckPVs tests that datastore name in existing PVs is short enough.
-func CheckPVs(clients clients.Interface, vmClient *govmomi.Client, config *vsphere.VSphereConfig) error {
-	var errs []error
+func CheckPVs(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
 	klog.V(4).Infof("CheckPVs started")
+	if checkCtx.KubeClient == nil {
+		return SkippedResult(noKubernetesReason), nil
+	}
 
-	pvs, err := clients.ListPVs()
+	pvs, err := checkCtx.KubeClient.ListPVs(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for i := range pvs {
-		pv := &pvs[i]
-		if pv.Spec.VsphereVolume == nil {
-			continue
-		}
-		klog.V(4).Infof("Checking PV %q : %s", pv.Name, pv.Spec.VsphereVolume.VolumePath)
-		err := checkVolumeName(pv.Spec.VsphereVolume.VolumePath)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("error checkin PV %q: %s", pv.Name, err))
+	result, err := checkCtx.parallelizeResults(ctx, len(pvs), func(i int, result *Result) {
+		checkPV(&pvs[i], result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Message = fmt.Sprintf("%d PVs checked", len(pvs))
+	klog.V(4).Infof("CheckPVs finished, %d PVs checked", len(pvs))
+	return result, nil
+}
+
+func checkPV(pv *v1.PersistentVolume, result *Result) {
+	if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == csiDriverName {
+		klog.V(4).Infof("Checking CSI PV %q : %s", pv.Name, pv.Spec.CSI.VolumeHandle)
+		if err := checkCSIVolumeName(pv.Name, pv.Spec.CSI.VolumeHandle); err != nil {
+			result.Fail(Object{Kind: KindPV, Name: pv.Name}, err.Error(), csiVolumeNameFix)
 		}
+		return
 	}
-	if len(errs) != 0 {
-		return errors.NewAggregate(errs)
+	if pv.Spec.VsphereVolume == nil {
+		return
+	}
+	klog.V(4).Infof("Checking PV %q : %s", pv.Name, pv.Spec.VsphereVolume.VolumePath)
+	if err := checkVolumeName(pv.Spec.VsphereVolume.VolumePath); err != nil {
+		result.Fail(Object{Kind: KindPV, Name: pv.Name}, err.Error(), "Move the volume to a datastore with shorter name")
 	}
-	klog.V(4).Infof("CheckPVs succeeded, %d PVs checked", len(pvs))
-	return nil
 }
 
 // CheckDefaultDatastore checks that the default data store name is short enough.
-func CheckDefaultDatastore(clients clients.Interface, config *vsphere.VSphereConfig) error {
+func CheckDefaultDatastore(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
 	klog.V(4).Infof("CheckDefaultDatastore started")
-	infra, err := clients.GetInfrastructure()
-	if err != nil {
-		return err
+	dsName := checkCtx.VMConfig.Workspace.DefaultDatastore
+	if dsName == "" {
+		return SkippedResult("no default datastore configured"), nil
 	}
+	result := NewResult()
+	if err := checkDataStore(dsName, checkCtx.ClusterID); err != nil {
+		result.Fail(Object{Kind: KindDatastore, Name: dsName}, fmt.Sprintf("default datastore is invalid: %s", err), datastoreNameFix)
+	}
+	klog.V(4).Infof("CheckDefaultDatastore finished")
+	return result, nil
+}
 
-	dsName := config.Workspace.DefaultDatastore
-	if err := checkDataStore(dsName, infra); err != nil {
-		return fmt.Errorf("Default data store %q is invalid: %s", dsName, err)
+// checkDatastoreExists checks that the datastore exists in at least one configured datacenter.
+func checkDatastoreExists(dsName string, inv *vmware.Inventory, object Object, result *Result) {
+	found := findDatastore(inv, dsName)
+	if len(found) == 0 {
+		result.Fail(object, fmt.Sprintf("datastore %q not found in any configured datacenter", dsName), "Use a datastore that exists in a datacenter listed in the cloud provider config")
+		return
 	}
-	klog.V(4).Infof("CheckDefaultDatastore succeeded")
-	return nil
+	var names []string
+	for i := range found {
+		names = append(names, found[i].String())
+	}
+	klog.V(4).Infof("Datastore %q found in datacenters %v", dsName, names)
 }
 
 // checkStoragePolicy lists all compatible datastores and checks their names are short.
-func checkStoragePolicy(policyName string, infrastructure *configv1.Infrastructure, vmClient *govmomi.Client) error {
+func checkStoragePolicy(ctx context.Context, policyName string, checkCtx *CheckContext, object Object, result *Result) {
+	dataStores, _ := getStoragePolicyDatastores(ctx, policyName, checkCtx, object, result)
+	for _, dataStore := range dataStores {
+		err := checkDataStore(dataStore, checkCtx.ClusterID)
+		if err != nil {
+			result.Fail(object, fmt.Sprintf("storage policy %q: %s", policyName, err), datastoreNameFix)
+		}
+	}
+}
+
+// getStoragePolicyDatastores returns names of all datastores compatible with
+// the storage policy. Errors are reported as failed findings, it returns
+// false when the datastores could not be listed.
+func getStoragePolicyDatastores(ctx context.Context, policyName string, checkCtx *CheckContext, object Object, result *Result) ([]string, bool) {
 	klog.V(4).Infof("Checking storage policy %q", policyName)
+	if !checkCtx.hasVCenterSession() {
+		// A vCenter that could not be connected is reported by the check.
+		reason := noVCenterReason
+		if len(checkCtx.VCenterErrors) > 0 {
+			reason = "the default vCenter is not connected"
+		}
+		result.Info(object, fmt.Sprintf("storage policy %q not checked: %s", policyName, reason))
+		return nil, false
+	}
+	vc := checkCtx.DefaultVCenter()
+	vmClient := vc.Client
 
-	pbm, err := getPolicy(policyName, vmClient)
+	pbm, err := getPolicy(ctx, policyName, vmClient)
 	if err != nil {
-		return err
+		result.Fail(object, fmt.Sprintf("error listing storage policy %q: %s", policyName, err), "")
+		return nil, false
 	}
 	if len(pbm) == 0 {
-		return fmt.Errorf("error listing storage policy %q: policy not found", policyName)
+		result.Fail(object, fmt.Sprintf("error listing storage policy %q: policy not found", policyName), "Create the storage policy or use an existing one in the storage class")
+		return nil, false
 	}
 	if len(pbm) > 1 {
-		return fmt.Errorf("error listing storage policy %q: multiple (%d) policies found", policyName, len(pbm))
+		result.Fail(object, fmt.Sprintf("error listing storage policy %q: multiple (%d) policies found", policyName, len(pbm)), "Use an unique storage policy name")
+		return nil, false
 	}
 
-	dataStores, err := getPolicyDatastores(pbm[0].GetPbmProfile().ProfileId, vmClient)
+	inv, err := checkCtx.GetInventory(ctx)
 	if err != nil {
-		return err
-	}
-	klog.V(4).Infof("Policy %q is compatible with datastores %v", policyName, dataStores)
-
-	var errs []error
-	for _, dataStore := range dataStores {
-		err := checkDataStore(dataStore, infrastructure)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("storage policy %q: %s", policyName, err))
-		}
-	}
-	if len(errs) > 0 {
-		return errors.NewAggregate(errs)
+		result.Fail(object, err.Error(), "")
+		return nil, false
 	}
-	return nil
-}
-
-// checkStoragePolicy lists all datastores compatible with given policy.
-func getPolicyDatastores(profileID types.PbmProfileId, vmClient *govmomi.Client) ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
-	defer cancel()
-
-	c, err := pbm.NewClient(ctx, vmClient.Client)
+	dataStores, err := getPolicyDatastores(ctx, pbm[0].GetPbmProfile().ProfileId, vmClient, inv.GetDatacenters(vc.Config.Server))
 	if err != nil {
-		return nil, err
+		result.Fail(object, fmt.Sprintf("error listing datastores of storage policy %q: %s", policyName, err), "")
+		return nil, false
 	}
+	klog.V(4).Infof("Policy %q is compatible with datastores %v", policyName, dataStores)
+	return dataStores, true
+}
 
-	// Load all datastores in vSphere
-	kind := []string{"Datastore"}
-	m := view.NewManager(vmClient.Client)
-
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
+// getPolicyDatastores lists all datastores in the datacenters that are compatible with given policy.
+func getPolicyDatastores(ctx context.Context, profileID types.PbmProfileId, vmClient *govmomi.Client, dcs []*vmware.InventoryDatacenter) ([]string, error) {
+	callCtx, cancel := context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
-	v, err := m.CreateContainerView(ctx, vmClient.Client.ServiceContent.RootFolder, kind, true)
-	if err != nil {
-		return nil, err
-	}
 
-	var content []vim.ObjectContent
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
-	defer cancel()
-	err = v.Retrieve(ctx, kind, []string{"name"}, &content)
-	_ = v.Destroy(ctx)
+	c, err := pbm.NewClient(callCtx, vmClient.Client)
 	if err != nil {
 		return nil, err
 	}
@@ -179,12 +217,14 @@ func getPolicyDatastores(profileID types.PbmProfileId, vmClient *govmomi.Client)
 	datastoreNames := make(map[string]string)
 	var hubs []types.PbmPlacementHub
 
-	for _, ds := range content {
-		hubs = append(hubs, types.PbmPlacementHub{
-			HubType: ds.Obj.Type,
-			HubId:   ds.Obj.Value,
-		})
-		datastoreNames[ds.Obj.Value] = ds.PropSet[0].Val.(string)
+	for _, dc := range dcs {
+		for _, ds := range dc.Datastores {
+			hubs = append(hubs, types.PbmPlacementHub{
+				HubType: ds.Ref.Type,
+				HubId:   ds.Ref.Value,
+			})
+			datastoreNames[ds.Ref.Value] = ds.Name
+		}
 	}
 
 	req := []types.BasePbmPlacementRequirement{
@@ -193,9 +233,9 @@ func getPolicyDatastores(profileID types.PbmProfileId, vmClient *govmomi.Client)
 		},
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
+	callCtx, cancel = context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
-	res, err := c.CheckRequirements(ctx, hubs, nil, req)
+	res, err := c.CheckRequirements(callCtx, hubs, nil, req)
 	if err != nil {
 		return nil, err
 	}
@@ -208,8 +248,8 @@ func getPolicyDatastores(profileID types.PbmProfileId, vmClient *govmomi.Client)
 	return dataStores, nil
 }
 
-func getPolicy(name string, vmClient *govmomi.Client) ([]types.BasePbmProfile, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
+func getPolicy(ctx context.Context, name string, vmClient *govmomi.Client) ([]types.BasePbmProfile, error) {
+	ctx, cancel := context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
 
 	c, err := pbm.NewClient(ctx, vmClient.Client)
@@ -240,46 +280,44 @@ func getPolicy(name string, vmClient *govmomi.Client) ([]types.BasePbmProfile, e
 }
 
 var (
-	cache sets.String = sets.NewString()
+	// cache of already checked datastores and their check results
+	cache     = map[string]error{}
+	cacheLock sync.Mutex
 )
 
-func checkDataStore(dsName string, infrastructure *configv1.Infrastructure) error {
+func checkDataStore(dsName string, clusterID string) error {
 	klog.V(4).Infof("Checking datastore %q", dsName)
-	if cache.Has(dsName) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if err, found := cache[dsName]; found {
 		klog.V(4).Infof("Skipping check of already checked datastore %q", dsName)
-		return nil
+		return err
 	}
-	cache.Insert(dsName)
 
-	clusterID := infrastructure.Status.InfrastructureName
 	volumeName := fmt.Sprintf("[%s] 5137595f-7ce3-e95a-5c03-06d835dea807/%s-dynamic-pvc-8533f1d0-178d-460b-8403-bc5e7dc7f778.vmdk", dsName, clusterID)
 	klog.V(4).Infof("Checking data store %q with potential volume name %s", dsName, volumeName)
-	if err := checkVolumeName(volumeName); err != nil {
-		return fmt.Errorf("error checking datastore %q: %s", dsName, err)
+	var err error
+	if err = checkVolumeName(volumeName); err != nil {
+		err = fmt.Errorf("error checking datastore %q: %s", dsName, err)
 	}
-	return nil
+	cache[dsName] = err
+	return err
 }
 
 func checkVolumeName(name string) error {
 	path := fmt.Sprintf("/var/lib/kubelet/plugins/kubernetes.io/vsphere-volume/mounts/%s", name)
-	escapedPath, err := systemdEscape(path)
-	if err != nil {
-		return fmt.Errorf("error running systemd-escape: %s", err)
-	}
-	if len(path) >= 255 {
-		return fmt.Errorf("escaped volume path %q is too long (must be under 255 characters, got %d)", escapedPath, len(escapedPath))
-	}
-	return nil
-
+	return checkMountPath(path)
 }
 
-func systemdEscape(path string) (string, error) {
-	cmd := exec.Command("systemd-escape", path)
-	out, err := cmd.CombinedOutput()
+// checkMountPath checks that systemd mount unit name of given mount path is short enough.
+func checkMountPath(path string) error {
+	unitName, err := systemd.MountUnitName(path)
 	if err != nil {
-		return "", fmt.Errorf("systemd-escape: %s: %s", err, string(out))
+		return fmt.Errorf("error escaping volume path %q: %s", path, err)
 	}
-	escapedPath := strings.TrimSpace(string(out))
-	klog.V(4).Infof("path %q systemd-escaped to %q (%d)", path, escapedPath, len(escapedPath))
-	return escapedPath, nil
+	klog.V(4).Infof("path %q systemd-escaped to %q (%d)", path, unitName, len(unitName))
+	if len(unitName) > systemd.UnitNameMax {
+		return fmt.Errorf("escaped volume path %q is too long (must be at most %d characters, got %d)", unitName, systemd.UnitNameMax, len(unitName))
+	}
+	return nil
 }
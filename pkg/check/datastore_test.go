@@ -0,0 +1,163 @@
+package check
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/systemd"
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckMountPath(t *testing.T) {
+	suffixLen := len(".mount")
+	tests := []struct {
+		name        string
+		path        string
+		expectError bool
+	}{
+		{
+			name: "short path",
+			path: "/var/lib/kubelet",
+		},
+		{
+			name: "unit name of maximum length",
+			path: "/" + strings.Repeat("a", systemd.UnitNameMax-suffixLen),
+		},
+		{
+			name:        "unit name one character too long",
+			path:        "/" + strings.Repeat("a", systemd.UnitNameMax-suffixLen+1),
+			expectError: true,
+		},
+		{
+			name: "escaped characters within the limit",
+			// Each space is escaped to 4 characters.
+			path: "/" + strings.Repeat(" ", (systemd.UnitNameMax-suffixLen)/4),
+		},
+		{
+			name:        "escaped characters over the limit",
+			path:        "/" + strings.Repeat(" ", (systemd.UnitNameMax-suffixLen)/4+1),
+			expectError: true,
+		},
+		{
+			name:        "not normalized path",
+			path:        "/a/../b",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkMountPath(test.path)
+			if test.expectError && err == nil {
+				t.Errorf("expected error, got none")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckCSIVolumeName(t *testing.T) {
+	tests := []struct {
+		name         string
+		pvName       string
+		volumeHandle string
+		expectError  bool
+	}{
+		{
+			name:         "provisioned PV",
+			pvName:       "pvc-8533f1d0-178d-460b-8403-bc5e7dc7f778",
+			volumeHandle: "0b2e8e3e-8cf3-4b5e-9a4f-3e5a2c1d2b6f",
+		},
+		{
+			name:         "long volume handle is hashed",
+			pvName:       "pvc-8533f1d0-178d-460b-8403-bc5e7dc7f778",
+			volumeHandle: strings.Repeat("a", 300),
+		},
+		{
+			name:         "too long PV name",
+			pvName:       strings.Repeat("a", systemd.UnitNameMax),
+			volumeHandle: "0b2e8e3e-8cf3-4b5e-9a4f-3e5a2c1d2b6f",
+			expectError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkCSIVolumeName(test.pvName, test.volumeHandle)
+			if test.expectError && err == nil {
+				t.Errorf("expected error, got none")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckCSIPV(t *testing.T) {
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", systemd.UnitNameMax)},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       csiDriverName,
+					VolumeHandle: "0b2e8e3e-8cf3-4b5e-9a4f-3e5a2c1d2b6f",
+				},
+			},
+		},
+	}
+	result := NewResult()
+	checkPV(pv, result)
+	if result.Status != StatusFail {
+		t.Fatalf("expected status %s, got %s", StatusFail, result.Status)
+	}
+	if result.Findings[0].Fix == "" {
+		t.Errorf("expected a fix of the finding, got none")
+	}
+}
+
+func TestCheckDatastoreURL(t *testing.T) {
+	inv := &vmware.Inventory{
+		Datacenters: []*vmware.InventoryDatacenter{
+			{
+				InventoryObject: vmware.InventoryObject{Name: "DC0"},
+				Datastores: []vmware.InventoryDatastore{
+					{
+						InventoryObject: vmware.InventoryObject{Name: "LocalDS_0"},
+						URL:             "ds:///vmfs/volumes/LocalDS_0/",
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus Status
+	}{
+		{
+			name:           "existing datastore",
+			url:            "ds:///vmfs/volumes/LocalDS_0/",
+			expectedStatus: StatusPass,
+		},
+		{
+			name:           "missing datastore",
+			url:            "ds:///vmfs/volumes/LocalDS_1/",
+			expectedStatus: StatusFail,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := NewResult()
+			checkDatastoreURL(test.url, inv, Object{Kind: KindStorageClass, Name: "sc"}, result)
+			if result.Status != test.expectedStatus {
+				t.Errorf("expected status %s, got %s: %+v", test.expectedStatus, result.Status, result.Findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	driftFix = "Make sure the operator that renders the copy is not degraded, or restart it to render the copy again"
+
+	// machineConfigCloudConfigPath is where machine-config-operator writes the cloud config on nodes.
+	machineConfigCloudConfigPath = "/etc/kubernetes/cloud.conf"
+)
+
+// renderedConfig is a copy of the cloud config rendered by an OpenShift operator.
+type renderedConfig struct {
+	object Object
+	secret bool
+	// pool is a MachineConfigPool, the copy is a file in its rendered MachineConfig.
+	pool string
+	// key is a key in the ConfigMap or Secret, or path of the file in the MachineConfig.
+	key string
+	// csi is true for the CSI driver config, which has no Workspace section.
+	csi bool
+}
+
+// renderedConfigs are all copies of the cloud config that are compared with the source config.
+var renderedConfigs = []renderedConfig{
+	{
+		object: Object{Kind: KindConfigMap, Name: "openshift-config-managed/kube-cloud-config"},
+		key:    "cloud.conf",
+	},
+	{
+		object: Object{Kind: KindConfigMap, Name: "openshift-kube-controller-manager/cloud-config"},
+		key:    "config",
+	},
+	{
+		object: Object{Kind: KindSecret, Name: "openshift-cluster-csi-drivers/vsphere-csi-config-secret"},
+		secret: true,
+		key:    "cloud.conf",
+		csi:    true,
+	},
+	{
+		object: Object{Kind: KindMachineConfigPool, Name: "master"},
+		pool:   "master",
+		key:    machineConfigCloudConfigPath,
+	},
+	{
+		object: Object{Kind: KindMachineConfigPool, Name: "worker"},
+		pool:   "worker",
+		key:    machineConfigCloudConfigPath,
+	},
+}
+
+// CheckConfigDrift compares the cloud config with its copies rendered by
+// OpenShift operators and reports semantic differences, i.e. different
+// vCenters, datacenters, default datastore or VM folder.
+func CheckConfigDrift(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+	klog.V(4).Infof("CheckConfigDrift started")
+	if checkCtx.KubeClient == nil {
+		return SkippedResult(noKubernetesReason), nil
+	}
+
+	result := NewResult()
+	compared := 0
+	for _, rc := range renderedConfigs {
+		data, object, err := getRenderedConfig(ctx, checkCtx, rc)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				klog.V(2).Infof("%s not found, skipping", rc.object)
+				continue
+			}
+			return nil, err
+		}
+		if data == "" {
+			what := "key"
+			if rc.pool != "" {
+				what = "file"
+			}
+			result.Warn(object, fmt.Sprintf("%s %s not found", what, rc.key), driftFix)
+			continue
+		}
+		cfg, err := vmware.ParseConfig(data)
+		if err != nil {
+			result.Fail(object, fmt.Sprintf("failed to parse config: %s", err), driftFix)
+			continue
+		}
+		compared++
+
+		expected := configFields(checkCtx.VMConfig, rc.csi)
+		actual := configFields(cfg, rc.csi)
+		for _, field := range sortedKeys(expected, actual) {
+			if expected[field] == actual[field] {
+				continue
+			}
+			result.Fail(object, fmt.Sprintf("%s is %q, expected %q", field, actual[field], expected[field]), driftFix)
+		}
+	}
+	if compared == 0 && len(result.Findings) == 0 {
+		return SkippedResult("no rendered copies of the config found"), nil
+	}
+	result.Message = fmt.Sprintf("%d rendered configs compared", compared)
+	klog.V(4).Infof("CheckConfigDrift finished")
+	return result, nil
+}
+
+// getRenderedConfig returns content of the rendered config or "" when it
+// does not have the key, together with the object that holds the copy.
+func getRenderedConfig(ctx context.Context, checkCtx *CheckContext, rc renderedConfig) (string, Object, error) {
+	if rc.pool != "" {
+		mc, err := checkCtx.KubeClient.GetRenderedMachineConfig(ctx, rc.pool)
+		if err != nil {
+			return "", rc.object, err
+		}
+		object := Object{Kind: KindMachineConfig, Name: mc.Name}
+		for _, f := range mc.Files {
+			if f.Path == rc.key {
+				return f.Contents, object, nil
+			}
+		}
+		return "", object, nil
+	}
+
+	parts := strings.SplitN(rc.object.Name, "/", 2)
+	namespace, name := parts[0], parts[1]
+	if rc.secret {
+		secret, err := checkCtx.KubeClient.GetSecret(ctx, namespace, name)
+		if err != nil {
+			return "", rc.object, err
+		}
+		return string(secret.Data[rc.key]), rc.object, nil
+	}
+	cm, err := checkCtx.KubeClient.GetConfigMap(ctx, namespace, name)
+	if err != nil {
+		return "", rc.object, err
+	}
+	return cm.Data[rc.key], rc.object, nil
+}
+
+// configFields returns values of the config that must be the same in all copies,
+// keyed by a human readable name. Datacenter lists are sorted, so their order
+// does not matter.
+func configFields(cfg *vmware.Config, csi bool) map[string]string {
+	fields := map[string]string{}
+	var servers []string
+	for _, vc := range vmware.GetVCenters(cfg) {
+		servers = append(servers, vc.Server)
+		dcs := append([]string{}, vc.Datacenters...)
+		sort.Strings(dcs)
+		fields[fmt.Sprintf("datacenters of vCenter %s", vc.Server)] = strings.Join(dcs, ",")
+	}
+	fields["vCenter servers"] = strings.Join(servers, ",")
+	if csi {
+		return fields
+	}
+	fields["Workspace server"] = cfg.Workspace.VCenterIP
+	fields["Workspace datacenter"] = cfg.Workspace.Datacenter
+	fields["Workspace default-datastore"] = cfg.Workspace.DefaultDatastore
+	fields["Workspace folder"] = cfg.Workspace.Folder
+	return fields
+}
+
+func sortedKeys(maps ...map[string]string) []string {
+	set := map[string]bool{}
+	for _, m := range maps {
+		for k := range m {
+			set[k] = true
+		}
+	}
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
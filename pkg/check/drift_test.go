@@ -0,0 +1,271 @@
+package check
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/clients"
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	ocpv1 "github.com/openshift/api/config/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeClients is clients.Interface with ConfigMaps, Secrets and rendered
+// MachineConfigs keyed by <namespace>/<name> and pool name.
+type fakeClients struct {
+	configMaps     map[string]*v1.ConfigMap
+	secrets        map[string]*v1.Secret
+	machineConfigs map[string]*clients.MachineConfig
+}
+
+var _ clients.Interface = &fakeClients{}
+
+func (f *fakeClients) GetInfrastructure(ctx context.Context) (*ocpv1.Infrastructure, error) {
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "config.openshift.io", Resource: "infrastructures"}, "cluster")
+}
+
+func (f *fakeClients) GetConfigMap(ctx context.Context, namespace, name string) (*v1.ConfigMap, error) {
+	if cm, found := f.configMaps[namespace+"/"+name]; found {
+		return cm, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+}
+
+func (f *fakeClients) GetSecret(ctx context.Context, namespace, name string) (*v1.Secret, error) {
+	if secret, found := f.secrets[namespace+"/"+name]; found {
+		return secret, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+}
+
+func (f *fakeClients) ListNodes(ctx context.Context) ([]v1.Node, error) {
+	return nil, nil
+}
+
+func (f *fakeClients) ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
+	return nil, nil
+}
+
+func (f *fakeClients) ListPVs(ctx context.Context) ([]v1.PersistentVolume, error) {
+	return nil, nil
+}
+
+func (f *fakeClients) GetRenderedMachineConfig(ctx context.Context, pool string) (*clients.MachineConfig, error) {
+	if mc, found := f.machineConfigs[pool]; found {
+		return mc, nil
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "machineconfiguration.openshift.io", Resource: "machineconfigpools"}, pool)
+}
+
+const driftTestConfig = `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+
+[Workspace]
+server = "vcenter.example.com"
+datacenter = "DC1"
+default-datastore = "ds1"
+folder = "/DC1/vm/cluster"
+
+[VirtualCenter "vcenter.example.com"]
+datacenters = "DC1"
+`
+
+const driftTestCSIConfig = `
+[Global]
+cluster-id = "cluster"
+
+[VirtualCenter "vcenter.example.com"]
+datacenters = "DC1"
+user = "admin"
+password = "secret"
+`
+
+func TestConfigFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		csi      bool
+		expected map[string]string
+	}{
+		{
+			name:   "in-tree config",
+			config: driftTestConfig,
+			expected: map[string]string{
+				"vCenter servers": "vcenter.example.com",
+				"datacenters of vCenter vcenter.example.com": "DC1",
+				"Workspace server":                           "vcenter.example.com",
+				"Workspace datacenter":                       "DC1",
+				"Workspace default-datastore":                "ds1",
+				"Workspace folder":                           "/DC1/vm/cluster",
+			},
+		},
+		{
+			name:   "CSI config has no Workspace",
+			config: driftTestCSIConfig,
+			csi:    true,
+			expected: map[string]string{
+				"vCenter servers": "vcenter.example.com",
+				"datacenters of vCenter vcenter.example.com": "DC1",
+			},
+		},
+		{
+			name:   "datacenters are sorted",
+			config: strings.Replace(driftTestCSIConfig, `datacenters = "DC1"`, `datacenters = "DC2,DC1"`, 1),
+			csi:    true,
+			expected: map[string]string{
+				"vCenter servers": "vcenter.example.com",
+				"datacenters of vCenter vcenter.example.com": "DC1,DC2",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := vmware.ParseConfig(test.config)
+			if err != nil {
+				t.Fatalf("failed to parse config: %s", err)
+			}
+			fields := configFields(cfg, test.csi)
+			if !reflect.DeepEqual(fields, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, fields)
+			}
+		})
+	}
+}
+
+func TestCheckConfigDrift(t *testing.T) {
+	kubeCloudConfig := func(config string) *v1.ConfigMap {
+		return &v1.ConfigMap{Data: map[string]string{"cloud.conf": config}}
+	}
+	csiSecret := func(config string) *v1.Secret {
+		return &v1.Secret{Data: map[string][]byte{"cloud.conf": []byte(config)}}
+	}
+	renderedMachineConfig := func(name, config string) *clients.MachineConfig {
+		return &clients.MachineConfig{
+			Name: name,
+			Files: []clients.MachineConfigFile{
+				{Path: "/etc/kubernetes/kubelet.conf", Contents: "kind: KubeletConfiguration"},
+				{Path: machineConfigCloudConfigPath, Contents: config},
+			},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		configMaps       map[string]*v1.ConfigMap
+		secrets          map[string]*v1.Secret
+		machineConfigs   map[string]*clients.MachineConfig
+		expectedStatus   Status
+		expectedFindings []string
+	}{
+		{
+			name:           "no rendered copies",
+			expectedStatus: StatusSkip,
+		},
+		{
+			name: "all copies match",
+			configMaps: map[string]*v1.ConfigMap{
+				"openshift-config-managed/kube-cloud-config": kubeCloudConfig(driftTestConfig),
+			},
+			secrets: map[string]*v1.Secret{
+				"openshift-cluster-csi-drivers/vsphere-csi-config-secret": csiSecret(driftTestCSIConfig),
+			},
+			machineConfigs: map[string]*clients.MachineConfig{
+				"master": renderedMachineConfig("rendered-master-1", driftTestConfig),
+			},
+			expectedStatus: StatusPass,
+		},
+		{
+			name: "different server",
+			configMaps: map[string]*v1.ConfigMap{
+				"openshift-config-managed/kube-cloud-config": kubeCloudConfig(strings.ReplaceAll(driftTestConfig, "vcenter.example.com", "vcenter2.example.com")),
+			},
+			expectedStatus: StatusFail,
+			expectedFindings: []string{
+				`ConfigMap "openshift-config-managed/kube-cloud-config": Workspace server is "vcenter2.example.com", expected "vcenter.example.com"`,
+				`ConfigMap "openshift-config-managed/kube-cloud-config": datacenters of vCenter vcenter.example.com is "", expected "DC1"`,
+				`ConfigMap "openshift-config-managed/kube-cloud-config": datacenters of vCenter vcenter2.example.com is "DC1", expected ""`,
+				`ConfigMap "openshift-config-managed/kube-cloud-config": vCenter servers is "vcenter2.example.com", expected "vcenter.example.com"`,
+			},
+		},
+		{
+			name: "different datacenter in the CSI driver config",
+			secrets: map[string]*v1.Secret{
+				"openshift-cluster-csi-drivers/vsphere-csi-config-secret": csiSecret(strings.Replace(driftTestCSIConfig, `"DC1"`, `"DC2"`, 1)),
+			},
+			expectedStatus: StatusFail,
+			expectedFindings: []string{
+				`Secret "openshift-cluster-csi-drivers/vsphere-csi-config-secret": datacenters of vCenter vcenter.example.com is "DC2", expected "DC1"`,
+			},
+		},
+		{
+			name: "different datastore",
+			configMaps: map[string]*v1.ConfigMap{
+				"openshift-kube-controller-manager/cloud-config": {Data: map[string]string{"config": strings.Replace(driftTestConfig, `"ds1"`, `"ds2"`, 1)}},
+			},
+			expectedStatus: StatusFail,
+			expectedFindings: []string{
+				`ConfigMap "openshift-kube-controller-manager/cloud-config": Workspace default-datastore is "ds2", expected "ds1"`,
+			},
+		},
+		{
+			name: "different folder in the rendered MachineConfig",
+			machineConfigs: map[string]*clients.MachineConfig{
+				"master": renderedMachineConfig("rendered-master-1", driftTestConfig),
+				"worker": renderedMachineConfig("rendered-worker-2", strings.Replace(driftTestConfig, "/DC1/vm/cluster", "/DC1/vm/old", 1)),
+			},
+			expectedStatus: StatusFail,
+			expectedFindings: []string{
+				`MachineConfig "rendered-worker-2": Workspace folder is "/DC1/vm/old", expected "/DC1/vm/cluster"`,
+			},
+		},
+		{
+			name: "rendered MachineConfig without the cloud config",
+			machineConfigs: map[string]*clients.MachineConfig{
+				"worker": {Name: "rendered-worker-2"},
+			},
+			expectedStatus: StatusWarn,
+			expectedFindings: []string{
+				`MachineConfig "rendered-worker-2": file /etc/kubernetes/cloud.conf not found`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := vmware.ParseConfig(driftTestConfig)
+			if err != nil {
+				t.Fatalf("failed to parse config: %s", err)
+			}
+			checkCtx := &CheckContext{
+				KubeClient: &fakeClients{
+					configMaps:     test.configMaps,
+					secrets:        test.secrets,
+					machineConfigs: test.machineConfigs,
+				},
+				VMConfig: cfg,
+			}
+			result, err := CheckConfigDrift(context.Background(), checkCtx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result.Status != test.expectedStatus {
+				t.Errorf("expected status %s, got %s", test.expectedStatus, result.Status)
+			}
+			var findings []string
+			for _, f := range result.Findings {
+				findings = append(findings, f.Object.String()+": "+f.Message)
+			}
+			if !reflect.DeepEqual(findings, test.expectedFindings) {
+				t.Errorf("expected findings:\n%s\ngot:\n%s", strings.Join(test.expectedFindings, "\n"), strings.Join(findings, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// adminRoleName is name of the built-in Administrator role.
+	adminRoleName = "Admin"
+
+	// maxListedPrivileges is the maximum number of privileges listed in a finding message.
+	// All of them are in the finding privileges.
+	maxListedPrivileges = 10
+)
+
+var (
+	// readOnlyPrivileges are privileges that every user with any permission has.
+	readOnlyPrivileges = []string{"System.Anonymous", "System.Read", "System.View"}
+
+	// entityKinds maps vSphere managed object types to kinds used in findings.
+	entityKinds = map[string]ObjectKind{
+		"Datacenter":                  KindDatacenter,
+		"Folder":                      KindFolder,
+		"ClusterComputeResource":      KindCluster,
+		"ComputeResource":             KindCluster,
+		"ResourcePool":                KindResourcePool,
+		"Datastore":                   KindDatastore,
+		"Network":                     KindNetwork,
+		"DistributedVirtualPortgroup": KindNetwork,
+		"OpaqueNetwork":               KindNetwork,
+		"VirtualMachine":              KindVirtualMachine,
+	}
+)
+
+// CheckExcessPrivileges warns when the vCenter user holds more privileges
+// than OpenShift needs, e.g. Administrator role at the root folder or VM
+// privileges on folders that are not used by the cluster.
+// Permissions of the user and of groups the user belongs to are checked in
+// all vCenters. A permission that propagates may grant privileges needed on
+// any cluster entity beneath it.
+func CheckExcessPrivileges(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+	klog.V(4).Infof("CheckExcessPrivileges started")
+	if !checkCtx.hasVCenterSession() {
+		return checkCtx.noVCenterResult(), nil
+	}
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
+	entities := checkCtx.getClusterEntities(ctx, result)
+	vms, err := getNodeVMEntities(ctx, checkCtx, result)
+	if err != nil {
+		return nil, err
+	}
+	entities = append(entities, vms...)
+
+	checked := 0
+	for _, vc := range checkCtx.VCenters {
+		var vcEntities []entity
+		for _, e := range entities {
+			if e.vc == vc {
+				vcEntities = append(vcEntities, e)
+			}
+		}
+		n, err := checkVCenterExcessPrivileges(ctx, checkCtx, vc, vcEntities, result)
+		if err != nil {
+			return nil, err
+		}
+		checked += n
+	}
+	result.Message = fmt.Sprintf("%d permissions of the vCenter user checked in %d vCenters", checked, len(checkCtx.VCenters))
+	klog.V(4).Infof("CheckExcessPrivileges finished, %d permissions checked", checked)
+	return result, nil
+}
+
+// checkVCenterExcessPrivileges checks permissions of the user in a single
+// vCenter with given cluster entities. It returns number of checked permissions.
+func checkVCenterExcessPrivileges(ctx context.Context, checkCtx *CheckContext, vc *vmware.VCenter, entities []entity, result *Result) (int, error) {
+	clusterEntities := map[types.ManagedObjectReference]Object{}
+	for _, e := range entities {
+		clusterEntities[e.ref] = e.object
+	}
+
+	perms, err := vmware.GetUserPermissions(ctx, vc)
+	if err != nil {
+		return 0, err
+	}
+	var descendants map[types.ManagedObjectReference]sets.String
+	for i := range perms {
+		if perms[i].Propagate {
+			descendants, err = getDescendantPrivileges(ctx, vc, entities)
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+	}
+	// Excess privileges of all permissions on the same entity are reported
+	// in a single finding, in the order of the permissions.
+	excessByEntity := map[types.ManagedObjectReference]*entityExcess{}
+	var order []types.ManagedObjectReference
+	for i := range perms {
+		perm := &perms[i]
+		object, found := clusterEntities[perm.Entity]
+		if !found {
+			path, err := vmware.InventoryPath(ctx, vc, perm.Entity)
+			if err != nil {
+				return 0, err
+			}
+			object = checkCtx.vSphereObject(vc, entityKind(perm.Entity), path)
+		}
+
+		allowed := sets.NewString(readOnlyPrivileges...)
+		if found {
+			allowed.Insert(RequiredPrivileges(object.Kind)...)
+		}
+		usedBelow := false
+		if perm.Propagate {
+			if privileges, ok := descendants[perm.Entity]; ok {
+				allowed = allowed.Union(privileges)
+				usedBelow = true
+			}
+		}
+		excess := sets.NewString(perm.Privileges...).Difference(allowed)
+		if excess.Len() == 0 {
+			klog.V(4).Infof("Role %q on %s does not grant any excess privileges", perm.Role, object)
+			continue
+		}
+
+		e, ok := excessByEntity[perm.Entity]
+		if !ok {
+			e = &entityExcess{object: object, privileges: sets.NewString(), unused: true}
+			excessByEntity[perm.Entity] = e
+			order = append(order, perm.Entity)
+		}
+		e.add(perm, excess, found || usedBelow)
+	}
+	for _, ref := range order {
+		result.Add(excessByEntity[ref].finding())
+	}
+	return len(perms), nil
+}
+
+// entityExcess are excess privileges granted on a single entity by all
+// permissions of the user and of its groups.
+type entityExcess struct {
+	object Object
+	// roles are names of roles that grant the excess privileges.
+	roles []string
+	// holders describe each role and who holds it, for the finding message.
+	holders    []string
+	privileges sets.String
+	// unused is true when the entity is not used by the cluster, neither
+	// directly nor through propagation.
+	unused bool
+	// unverified is true when all permissions are of groups whose
+	// membership could not be verified.
+	unverified bool
+}
+
+// add adds excess privileges of a permission on the entity.
+func (e *entityExcess) add(perm *vmware.UserPermission, excess sets.String, used bool) {
+	holder := "the user"
+	if perm.Group {
+		holder = fmt.Sprintf("group %s", perm.Principal)
+	}
+	role := fmt.Sprintf("role %q", perm.Role)
+	if perm.Role == adminRoleName {
+		role = "Administrator role"
+	}
+	desc := fmt.Sprintf("%s of %s", role, holder)
+	if perm.Unverified {
+		desc += " (membership unverified)"
+	}
+	if len(e.holders) == 0 {
+		e.unverified = perm.Unverified
+	} else {
+		e.unverified = e.unverified && perm.Unverified
+	}
+	e.roles = append(e.roles, fmt.Sprintf("%q", perm.Role))
+	e.holders = append(e.holders, desc)
+	e.privileges = e.privileges.Union(excess)
+	if used {
+		e.unused = false
+	}
+}
+
+// finding returns a single finding with all excess privileges on the entity.
+func (e *entityExcess) finding() Finding {
+	verb := "grants"
+	roles := "role " + e.roles[0]
+	if len(e.roles) > 1 {
+		verb = "grant"
+		roles = "roles " + strings.Join(e.roles, ", ")
+	}
+	excess := e.privileges.List()
+	msg := fmt.Sprintf("%s %s %d privileges not needed by OpenShift: %s", strings.Join(e.holders, ", "), verb, len(excess), listPrivileges(excess))
+	if e.unused {
+		msg += " (the entity is not used by the cluster)"
+	}
+	severity := StatusWarn
+	if e.unverified {
+		// The user may not be member of the groups at all.
+		severity = StatusInfo
+	}
+	return Finding{
+		Severity:   severity,
+		Object:     e.object,
+		Message:    msg,
+		Fix:        fmt.Sprintf("Replace %s with a role that has only the privileges OpenShift needs on %s %s", roles, e.object.Kind, e.object.Name),
+		Privileges: excess,
+	}
+}
+
+// getDescendantPrivileges returns privileges needed on cluster entities
+// beneath each of their ancestors, i.e. privileges that a propagating
+// permission on the ancestor may grant.
+func getDescendantPrivileges(ctx context.Context, vc *vmware.VCenter, entities []entity) (map[types.ManagedObjectReference]sets.String, error) {
+	descendants := map[types.ManagedObjectReference]sets.String{}
+	for _, e := range entities {
+		ancestors, err := vmware.Ancestors(ctx, vc, e.ref)
+		if err != nil {
+			return nil, err
+		}
+		// ancestors[0] is the entity itself.
+		for _, ref := range ancestors[1:] {
+			if _, ok := descendants[ref]; !ok {
+				descendants[ref] = sets.NewString()
+			}
+			descendants[ref].Insert(RequiredPrivileges(e.object.Kind)...)
+		}
+	}
+	return descendants, nil
+}
+
+func entityKind(ref types.ManagedObjectReference) ObjectKind {
+	if kind, found := entityKinds[ref.Type]; found {
+		return kind
+	}
+	return ObjectKind(ref.Type)
+}
+
+// listPrivileges returns comma separated list of the first maxListedPrivileges privileges.
+func listPrivileges(privileges []string) string {
+	if len(privileges) <= maxListedPrivileges {
+		return strings.Join(privileges, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(privileges[:maxListedPrivileges], ", "), len(privileges)-maxListedPrivileges)
+}
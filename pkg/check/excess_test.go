@@ -0,0 +1,90 @@
+package check
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestEntityExcessFinding(t *testing.T) {
+	object := Object{Kind: KindFolder, Name: "/DC1/vm"}
+	userPerm := &vmware.UserPermission{Principal: `VSPHERE.LOCAL\k8s`, Role: adminRoleName}
+	groupPerm := &vmware.UserPermission{Principal: `VSPHERE.LOCAL\k8s-admins`, Group: true, Role: "vm-admin"}
+	unverifiedPerm := &vmware.UserPermission{Principal: `VSPHERE.LOCAL\admins`, Group: true, Unverified: true, Role: "net-admin"}
+	type permExcess struct {
+		perm   *vmware.UserPermission
+		excess []string
+		used   bool
+	}
+	tests := []struct {
+		name               string
+		perms              []permExcess
+		expectedSeverity   Status
+		expectedMessage    string
+		expectedFix        string
+		expectedPrivileges []string
+	}{
+		{
+			name:               "single role",
+			perms:              []permExcess{{perm: groupPerm, excess: []string{"VirtualMachine.Config.Memory"}, used: true}},
+			expectedSeverity:   StatusWarn,
+			expectedMessage:    `role "vm-admin" of group VSPHERE.LOCAL\k8s-admins grants 1 privileges not needed by OpenShift: VirtualMachine.Config.Memory`,
+			expectedFix:        `Replace role "vm-admin" with a role that has only the privileges OpenShift needs on Folder /DC1/vm`,
+			expectedPrivileges: []string{"VirtualMachine.Config.Memory"},
+		},
+		{
+			name: "roles of the user and of a group are merged",
+			perms: []permExcess{
+				{perm: userPerm, excess: []string{"Global.Licenses", "VirtualMachine.Config.Memory"}},
+				{perm: groupPerm, excess: []string{"VirtualMachine.Config.CPUCount", "VirtualMachine.Config.Memory"}},
+			},
+			expectedSeverity:   StatusWarn,
+			expectedMessage:    `Administrator role of the user, role "vm-admin" of group VSPHERE.LOCAL\k8s-admins grant 3 privileges not needed by OpenShift: Global.Licenses, VirtualMachine.Config.CPUCount, VirtualMachine.Config.Memory (the entity is not used by the cluster)`,
+			expectedFix:        `Replace roles "Admin", "vm-admin" with a role that has only the privileges OpenShift needs on Folder /DC1/vm`,
+			expectedPrivileges: []string{"Global.Licenses", "VirtualMachine.Config.CPUCount", "VirtualMachine.Config.Memory"},
+		},
+		{
+			name: "verified role makes the finding a warning",
+			perms: []permExcess{
+				{perm: unverifiedPerm, excess: []string{"Network.Delete"}, used: true},
+				{perm: groupPerm, excess: []string{"VirtualMachine.Config.Memory"}},
+			},
+			expectedSeverity:   StatusWarn,
+			expectedMessage:    `role "net-admin" of group VSPHERE.LOCAL\admins (membership unverified), role "vm-admin" of group VSPHERE.LOCAL\k8s-admins grant 2 privileges not needed by OpenShift: Network.Delete, VirtualMachine.Config.Memory`,
+			expectedFix:        `Replace roles "net-admin", "vm-admin" with a role that has only the privileges OpenShift needs on Folder /DC1/vm`,
+			expectedPrivileges: []string{"Network.Delete", "VirtualMachine.Config.Memory"},
+		},
+		{
+			name:               "only unverified roles",
+			perms:              []permExcess{{perm: unverifiedPerm, excess: []string{"Network.Delete"}, used: true}},
+			expectedSeverity:   StatusInfo,
+			expectedMessage:    `role "net-admin" of group VSPHERE.LOCAL\admins (membership unverified) grants 1 privileges not needed by OpenShift: Network.Delete`,
+			expectedFix:        `Replace role "net-admin" with a role that has only the privileges OpenShift needs on Folder /DC1/vm`,
+			expectedPrivileges: []string{"Network.Delete"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := &entityExcess{object: object, privileges: sets.NewString(), unused: true}
+			for _, p := range test.perms {
+				e.add(p.perm, sets.NewString(p.excess...), p.used)
+			}
+			f := e.finding()
+			if f.Severity != test.expectedSeverity {
+				t.Errorf("expected severity %s, got %s", test.expectedSeverity, f.Severity)
+			}
+			if f.Message != test.expectedMessage {
+				t.Errorf("expected message:\n%s\ngot:\n%s", test.expectedMessage, f.Message)
+			}
+			if f.Fix != test.expectedFix {
+				t.Errorf("expected fix:\n%s\ngot:\n%s", test.expectedFix, f.Fix)
+			}
+			if !reflect.DeepEqual(f.Privileges, test.expectedPrivileges) {
+				t.Errorf("expected privileges %v, got %v", test.expectedPrivileges, f.Privileges)
+			}
+		})
+	}
+}
@@ -3,14 +3,16 @@ package check
 import (
 	"context"
 	"fmt"
+	"path"
 
 	"github.com/jsafrane/vmware-check/pkg/vmware"
-	"github.com/vmware/govmomi"
-	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/types"
 	"k8s.io/klog/v2"
-	"k8s.io/legacy-cloud-providers/vsphere"
+)
+
+const (
+	browseFix = "Grant the vCenter user Datastore.Browse privilege on the default datastore"
 )
 
 // CheckFolderList tests that OCP has permissions to list volumes in Datastore.
@@ -18,47 +20,85 @@ import (
 // The check lists datastore's "/", which must exist.
 // The check tries to list "kubevols/". It tolerates when it's missing,
 // it will be created by OCP on the first provisioning.
-func CheckFolderList(vmClient *govmomi.Client, config *vsphere.VSphereConfig) error {
+func CheckFolderList(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
 	klog.V(4).Infof("CheckFolderList started")
+	config := checkCtx.VMConfig
+	if config.Workspace.DefaultDatastore == "" {
+		return SkippedResult("no default datastore configured"), nil
+	}
+	if !checkCtx.hasVCenterSession() {
+		return checkCtx.noVCenterResult(), nil
+	}
+	vc := checkCtx.DefaultVCenter()
 
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
-	defer cancel()
-
-	finder := find.NewFinder(vmClient.Client, false)
-	dc, err := finder.Datacenter(ctx, config.Workspace.Datacenter)
+	inv, err := checkCtx.GetInventory(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to access Datacenter %s: %s", config.Workspace.Datacenter, err)
+		return nil, err
+	}
+	dc := inv.GetDatacenter(vc.Config.Server, config.Workspace.Datacenter)
+	if dc == nil {
+		return nil, fmt.Errorf("failed to access Datacenter %s: not found in vCenter %s", config.Workspace.Datacenter, vc.Config.Server)
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
-	defer cancel()
-	finder.SetDatacenter(dc)
-	ds, err := finder.Datastore(ctx, config.Workspace.DefaultDatastore)
-	if err != nil {
-		return fmt.Errorf("failed to access Datastore %s: %s", config.Workspace.DefaultDatastore, err)
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
+	object := Object{Kind: KindDatastore, Name: config.Workspace.DefaultDatastore}
+	ds := findInventoryDatastore(vc, dc, config.Workspace.DefaultDatastore)
+	if ds == nil {
+		result.Fail(object, fmt.Sprintf("failed to access Datastore %s: not found in %s", config.Workspace.DefaultDatastore, dc.String()), "Make sure the default datastore exists and the vCenter user has permissions to access it")
+		return result, nil
 	}
+	object.Name = ds.InventoryPath
 	// OCP needs permissions to list files, try "/" that must exists.
-	err = listDirectory(config, ds, "/", false)
+	err = listDirectory(ctx, config, ds, "/", false)
 	if err != nil {
-		return err
+		failBrowse(result, object, err)
+		return result, nil
 	}
 
 	// OCP needs permissions to list "/kubelet", tolerate if it does not exist.
-	err = listDirectory(config, ds, "/kubevols", true)
+	err = listDirectory(ctx, config, ds, "/kubevols", true)
 	if err != nil {
-		return err
+		failBrowse(result, object, err)
+		return result, nil
 	}
 
-	klog.Infof("Listing Datastore %q succeeded", config.Workspace.DefaultDatastore)
+	result.Message = fmt.Sprintf("listing Datastore %q succeeded", config.Workspace.DefaultDatastore)
+	klog.V(4).Infof("Listing Datastore %q succeeded", config.Workspace.DefaultDatastore)
+	return result, nil
+}
+
+// findInventoryDatastore returns datastore with given name or inventory path
+// in the datacenter, or nil when it's not in the inventory. InventoryPath
+// of the returned datastore is the absolute inventory path.
+func findInventoryDatastore(vc *vmware.VCenter, dc *vmware.InventoryDatacenter, dsName string) *object.Datastore {
+	name := path.Base(dsName)
+	for i := range dc.Datastores {
+		if dc.Datastores[i].Name == name {
+			ds := object.NewDatastore(vc.Client.Client, dc.Datastores[i].Ref)
+			ds.InventoryPath = dc.DatastorePath(dsName)
+			return ds
+		}
+	}
 	return nil
 }
 
-func listDirectory(config *vsphere.VSphereConfig, ds *object.Datastore, path string, tolerateNotFound bool) error {
+func failBrowse(result *Result, object Object, err error) {
+	result.Add(Finding{
+		Severity:   StatusFail,
+		Object:     object,
+		Message:    err.Error(),
+		Fix:        browseFix,
+		Privileges: []string{"Datastore.Browse"},
+	})
+}
+
+func listDirectory(ctx context.Context, config *vmware.Config, ds *object.Datastore, path string, tolerateNotFound bool) error {
 	klog.V(4).Infof("Listing datastore %s path %s", ds.Name(), path)
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
+	callCtx, cancel := context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
 
-	browser, err := ds.Browser(ctx)
+	browser, err := ds.Browser(callCtx)
 	if err != nil {
 		return fmt.Errorf("failed to create Datastore %s browser: %s", config.Workspace.DefaultDatastore, err)
 	}
@@ -66,9 +106,9 @@ func listDirectory(config *vsphere.VSphereConfig, ds *object.Datastore, path str
 	spec := types.HostDatastoreBrowserSearchSpec{
 		MatchPattern: []string{"*"},
 	}
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
+	callCtx, cancel = context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
-	task, err := browser.SearchDatastore(ctx, ds.Path(path), &spec)
+	task, err := browser.SearchDatastore(callCtx, ds.Path(path), &spec)
 	if err != nil {
 		if tolerateNotFound && types.IsFileNotFound(err) {
 			klog.Infof("Warning: path %s does not exist it Datastore %s", path, config.Workspace.DefaultDatastore)
@@ -77,9 +117,9 @@ func listDirectory(config *vsphere.VSphereConfig, ds *object.Datastore, path str
 		return fmt.Errorf("failed to browse Datastore %s: %s", config.Workspace.DefaultDatastore, err)
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
+	callCtx, cancel = context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
-	info, err := task.WaitForResult(ctx, nil)
+	info, err := task.WaitForResult(callCtx, nil)
 	if err != nil {
 		if tolerateNotFound && types.IsFileNotFound(err) {
 			klog.Infof("Warning: path %s does not exist it Datastore %s", path, config.Workspace.DefaultDatastore)
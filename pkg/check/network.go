@@ -0,0 +1,47 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"k8s.io/klog/v2"
+)
+
+// CheckNetwork tests that the network configured in Network.PublicNetwork
+// exists in the Workspace datacenter.
+func CheckNetwork(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+	klog.V(4).Infof("CheckNetwork started")
+	config := checkCtx.VMConfig
+	networkName := config.Network.PublicNetwork
+	if networkName == "" {
+		return SkippedResult("no network configured"), nil
+	}
+
+	inv, err := checkCtx.GetInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
+	server := checkCtx.defaultServer()
+	if _, failed := checkCtx.VCenterErrors[server]; failed {
+		return result, nil
+	}
+	dc := inv.GetDatacenter(server, config.Workspace.Datacenter)
+	if dc == nil {
+		return nil, fmt.Errorf("failed to access Datacenter %s: not found in vCenter %s", config.Workspace.Datacenter, server)
+	}
+
+	name := path.Base(networkName)
+	for _, network := range dc.Networks {
+		if network.Name == name {
+			result.Message = fmt.Sprintf("network %q found in %s", network.Name, dc.String())
+			klog.V(4).Infof("CheckNetwork finished")
+			return result, nil
+		}
+	}
+	result.Fail(Object{Kind: KindNetwork, Name: networkName}, fmt.Sprintf("network %s not found in %s", networkName, dc.String()), "Make sure the network exists in the datacenter and the vCenter user has permissions to access it")
+	klog.V(4).Infof("CheckNetwork finished")
+	return result, nil
+}
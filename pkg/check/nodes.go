@@ -3,105 +3,119 @@ package check
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
-	"github.com/jsafrane/vmware-check/pkg/clients"
-	"github.com/jsafrane/vmware-check/pkg/vmware"
-	"github.com/vmware/govmomi"
-	"github.com/vmware/govmomi/find"
-	"github.com/vmware/govmomi/object"
-	"github.com/vmware/govmomi/vim25/mo"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
-	"k8s.io/legacy-cloud-providers/vsphere"
+)
+
+const (
+	diskUUIDFix = "Shut down the node's VM and set its disk.enableUUID option to TRUE"
+
+	// minCSIHardwareVersion is the minimal VM hardware version required by
+	// the vSphere CSI driver and by CSI migration.
+	minCSIHardwareVersion = 15
+	hardwareVersionFix    = "Shut down the node's VM and upgrade its compatibility (hardware version) to vmx-15 or newer"
+)
+
+// csiReadiness is whether a node's VM is ready for the vSphere CSI driver.
+type csiReadiness int
+
+const (
+	csiReady csiReadiness = iota
+	// csiBlocking means the VM blocks CSI migration or upgrade.
+	csiBlocking
+	// csiUnknown means readiness could not be determined, e.g. the VM was not found.
+	csiUnknown
 )
 
 // CheckNodes tests that Nodes have spec.providerID (i.e. they run with a cloud provider)
-// and all nodes have disk.enableUUID enabled.
-func CheckNodes(clients clients.Interface, vmClient *govmomi.Client, config *vsphere.VSphereConfig) error {
+// and all nodes have disk.enableUUID enabled and hardware version supported
+// by the vSphere CSI driver.
+func CheckNodes(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
 	klog.V(4).Infof("CheckNodes started")
-
-	nodes, err := clients.ListNodes()
-	if err != nil {
-		return err
+	if checkCtx.KubeClient == nil {
+		return SkippedResult(noKubernetesReason), nil
 	}
-	badNodes := 0
-	for i := range nodes {
-		node := &nodes[i]
 
-		err := checkNode(node, vmClient, config)
-		if err != nil {
-			badNodes++
-			klog.V(2).Infof("Error on node %q: %s", node.Name, err)
+	var blocking, unknown int32
+	result, err := checkCtx.checkNodes(ctx, func(vms *vmIndex, node *v1.Node, result *Result) {
+		switch checkNode(vms, node, result) {
+		case csiBlocking:
+			atomic.AddInt32(&blocking, 1)
+		case csiUnknown:
+			atomic.AddInt32(&unknown, 1)
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	if badNodes > 0 {
-		return fmt.Errorf("%d nodes have issues", badNodes)
+	if blocking > 0 {
+		result.Message += fmt.Sprintf(", %d nodes block CSI migration or upgrade", blocking)
+	}
+	if unknown > 0 {
+		result.Message += fmt.Sprintf(", %d nodes with unknown CSI readiness", unknown)
 	}
-	klog.Infof("CheckNodes succeeded, %d nodes checked", len(nodes))
-	return nil
+	klog.V(4).Infof("CheckNodes finished, %s", result.Message)
+	return result, nil
 }
 
-func checkNode(node *v1.Node, vmClient *govmomi.Client, config *vsphere.VSphereConfig) error {
+// checkNode checks a single node and returns whether its VM is ready for
+// the vSphere CSI driver.
+func checkNode(vms *vmIndex, node *v1.Node, result *Result) csiReadiness {
 	klog.V(4).Infof("Checking node %q", node.Name)
+	object := Object{Kind: KindNode, Name: node.Name}
 	if node.Spec.ProviderID == "" {
-		return fmt.Errorf("the node has no providerID")
+		result.Fail(object, "the node has no providerID", "Make sure the node runs with vSphere cloud provider enabled")
+		return csiUnknown
 	}
 	klog.V(4).Infof("... the node has providerID: %s", node.Spec.ProviderID)
 
 	if !strings.HasPrefix(node.Spec.ProviderID, "vsphere://") {
-		return fmt.Errorf("the node's providerID does not start with vsphere://")
+		result.Fail(object, "the node's providerID does not start with vsphere://", "Make sure the node runs with vSphere cloud provider enabled")
+		return csiUnknown
 	}
 
-	if err := checkDiskUUID(node, vmClient, config); err != nil {
-		return err
-	}
-	return nil
-}
-
-func checkDiskUUID(node *v1.Node, vmClient *govmomi.Client, config *vsphere.VSphereConfig) error {
-	vm, err := getVM(node, vmClient, config)
+	vm, err := vms.getNodeVM(node)
 	if err != nil {
-		return err
+		result.Fail(object, err.Error(), "Make sure the node's VM exists in a configured datacenter and the vCenter user has permissions to read it")
+		return csiUnknown
 	}
+	result.Info(object, fmt.Sprintf("the node's VM is in datacenter %s", vm.dc.String()))
 
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
-	defer cancel()
-	var o mo.VirtualMachine
-	err = vm.Properties(ctx, vm.Reference(), []string{"config.extraConfig", "config.flags"}, &o)
-	if err != nil {
-		return fmt.Errorf("failed to load VM %s: %s", node.Name, err)
-	}
+	checkDiskUUID(node, vm, result)
+	return checkHardwareVersion(node, vm, result)
+}
 
-	if o.Config.Flags.DiskUuidEnabled == nil {
-		return fmt.Errorf("node %q has empty disk.enableUUID", node.Name)
+func checkDiskUUID(node *v1.Node, vm *nodeVM, result *Result) {
+	object := Object{Kind: KindNode, Name: node.Name}
+	if vm.vm.DiskUUIDEnabled == nil {
+		result.Fail(object, "the node has empty disk.enableUUID", diskUUIDFix)
+		return
 	}
-	if *o.Config.Flags.DiskUuidEnabled == false {
-		return fmt.Errorf("node %q has disk.enableUUID = FALSE", node.Name)
+	if *vm.vm.DiskUUIDEnabled == false {
+		result.Fail(object, "the node has disk.enableUUID = FALSE", diskUUIDFix)
+		return
 	}
 	klog.V(4).Infof("... the node has correct disk.enableUUID")
-
-	return nil
 }
 
-func getVM(node *v1.Node, vmClient *govmomi.Client, config *vsphere.VSphereConfig) (*object.VirtualMachine, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
-	defer cancel()
-
-	finder := find.NewFinder(vmClient.Client, false)
-	dc, err := finder.Datacenter(ctx, config.Workspace.Datacenter)
-	if err != nil {
-		return nil, fmt.Errorf("failed to access Datacenter %s: %s", config.Workspace.Datacenter, err)
-	}
-	s := object.NewSearchIndex(dc.Client())
-	vmUUID := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(node.Spec.ProviderID, "vsphere://")))
-	svm, err := s.FindByUuid(ctx, dc, vmUUID, true, nil)
+// checkHardwareVersion checks that hardware version of the node's VM is
+// supported by the vSphere CSI driver.
+func checkHardwareVersion(node *v1.Node, vm *nodeVM, result *Result) csiReadiness {
+	object := Object{Kind: KindNode, Name: node.Name}
+	hwVersion := vm.vm.HardwareVersion
+	version, err := strconv.Atoi(strings.TrimPrefix(hwVersion, "vmx-"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to find VM by UUID %s: %s", vmUUID, err)
+		result.Warn(object, fmt.Sprintf("unable to parse hardware version %q of the node's VM", hwVersion), "Make sure the vCenter user has permissions to read the node's VM")
+		return csiUnknown
 	}
-	if svm == nil {
-		return nil, fmt.Errorf("fnable to find VM by UUID %s", vmUUID)
+	if version < minCSIHardwareVersion {
+		result.Warn(object, fmt.Sprintf("the node's VM has hardware version %s, the vSphere CSI driver requires vmx-%d or newer", hwVersion, minCSIHardwareVersion), hardwareVersionFix)
+		return csiBlocking
 	}
-	return object.NewVirtualMachine(vmClient.Client, svm.Reference()), nil
+	klog.V(4).Infof("... the node has hardware version %s", hwVersion)
+	return csiReady
 }
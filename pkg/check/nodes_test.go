@@ -0,0 +1,90 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckNodeReadiness(t *testing.T) {
+	enabled := true
+	vm := func(uuid, hwVersion string) vmware.InventoryVM {
+		return vmware.InventoryVM{
+			InventoryObject: vmware.InventoryObject{Name: uuid},
+			BIOSUUID:        uuid,
+			DiskUUIDEnabled: &enabled,
+			HardwareVersion: hwVersion,
+		}
+	}
+	inv := &vmware.Inventory{
+		Datacenters: []*vmware.InventoryDatacenter{
+			{
+				InventoryObject: vmware.InventoryObject{Name: "DC0"},
+				VCenter:         "vcenter.example.com",
+				VMs: []vmware.InventoryVM{
+					vm("vm-15", "vmx-15"),
+					vm("vm-13", "vmx-13"),
+					vm("vm-unparsable", "vmx-latest"),
+					vm("vm-empty", ""),
+				},
+			},
+		},
+	}
+	vms := buildVMIndex(inv)
+
+	tests := []struct {
+		name       string
+		providerID string
+		expected   csiReadiness
+	}{
+		{
+			name:       "supported hardware version",
+			providerID: "vsphere://vm-15",
+			expected:   csiReady,
+		},
+		{
+			name:       "old hardware version",
+			providerID: "vsphere://vm-13",
+			expected:   csiBlocking,
+		},
+		{
+			name:       "unparsable hardware version",
+			providerID: "vsphere://vm-unparsable",
+			expected:   csiUnknown,
+		},
+		{
+			name:       "empty hardware version",
+			providerID: "vsphere://vm-empty",
+			expected:   csiUnknown,
+		},
+		{
+			name:     "no providerID",
+			expected: csiUnknown,
+		},
+		{
+			name:       "providerID of another cloud",
+			providerID: "aws:///us-east-1a/i-0123456789",
+			expected:   csiUnknown,
+		},
+		{
+			name:       "VM not found",
+			providerID: "vsphere://missing",
+			expected:   csiUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node"},
+				Spec:       v1.NodeSpec{ProviderID: test.providerID},
+			}
+			readiness := checkNode(vms, node, NewResult())
+			if readiness != test.expected {
+				t.Errorf("expected readiness %d, got %d", test.expected, readiness)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// CheckPermissions reports where permissions of the vCenter user on entities
+// used by the cluster (and on VMs of all nodes) come from: which role grants
+// them and on which ancestor entity it is assigned. Permissions of each
+// entity are read from its own vCenter.
+func CheckPermissions(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+	klog.V(4).Infof("CheckPermissions started")
+	if !checkCtx.hasVCenterSession() {
+		return checkCtx.noVCenterResult(), nil
+	}
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
+	entities := checkCtx.getClusterEntities(ctx, result)
+	vms, err := getNodeVMEntities(ctx, checkCtx, result)
+	if err != nil {
+		return nil, err
+	}
+	entities = append(entities, vms...)
+
+	sources := make([][]vmware.PermissionSource, len(entities))
+	errs := make([]error, len(entities))
+	err = checkCtx.parallelize(ctx, len(entities), func(i int) {
+		sources[i], errs[i] = vmware.GetPermissionSources(ctx, entities[i].vc, entities[i].ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entities {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		reportPermissionSources(e, sources[i], result)
+	}
+	result.Message = fmt.Sprintf("permissions of %d entities checked", len(entities))
+	klog.V(4).Infof("CheckPermissions finished, %d entities checked", len(entities))
+	return result, nil
+}
+
+// getNodeVMEntities returns VMs of all nodes, each with its own vCenter.
+// Nodes whose VMs cannot be found are skipped, they're reported by CheckNodes.
+// Nodes whose VMs are in a vCenter without connection are skipped with an
+// informative finding. No VMs are returned when Kubernetes API is not available.
+func getNodeVMEntities(ctx context.Context, checkCtx *CheckContext, result *Result) ([]entity, error) {
+	if checkCtx.KubeClient == nil {
+		return nil, nil
+	}
+	nodes, err := checkCtx.KubeClient.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vms, err := checkCtx.getVMIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entities []entity
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Spec.ProviderID == "" {
+			continue
+		}
+		vm, err := vms.getNodeVM(node)
+		if err != nil {
+			klog.V(2).Infof("Skipping permissions of node %q: %s", node.Name, err)
+			continue
+		}
+		vc := checkCtx.getVCenter(vm.dc.VCenter)
+		if vc == nil {
+			result.Info(Object{Kind: KindNode, Name: node.Name}, fmt.Sprintf("VM of the node is in vCenter %s, which is not connected, its permissions were not checked", vm.dc.VCenter))
+			continue
+		}
+		entities = append(entities, entity{
+			object: checkCtx.vSphereObject(vc, KindVirtualMachine, node.Name),
+			ref:    vm.vm.Ref,
+			vc:     vc,
+		})
+	}
+	return entities, nil
+}
+
+// reportPermissionSources adds an informative finding with all permissions of
+// the entity and a warning for each required privilege that is granted on an
+// ancestor, but the permission does not propagate to the entity or it's
+// overridden by a permission closer to the entity.
+// Permissions of groups with unverified membership are listed, but they're
+// not counted as granting any privilege.
+func reportPermissionSources(e entity, sources []vmware.PermissionSource, result *Result) {
+	if len(sources) == 0 {
+		result.Info(e.object, "no permissions of the vCenter user or any group found on the entity or its ancestors")
+		return
+	}
+
+	effective := map[int]bool{}
+	granted := sets.NewString()
+	for _, i := range vmware.EffectiveSources(sources) {
+		effective[i] = true
+		granted.Insert(sources[i].Privileges...)
+	}
+	var lines []string
+	for i := range sources {
+		lines = append(lines, describePermission(&sources[i], effective[i]))
+	}
+	result.Info(e.object, fmt.Sprintf("effective permissions: %s", strings.Join(lines, "; ")))
+
+	for _, priv := range RequiredPrivileges(e.object.Kind) {
+		if granted.Has(priv) {
+			continue
+		}
+		for i := range sources {
+			s := &sources[i]
+			if effective[i] || s.Unverified || !sets.NewString(s.Privileges...).Has(priv) {
+				continue
+			}
+			if !s.Applies() {
+				result.Warn(e.object, fmt.Sprintf("privilege %s is granted by role %q on %s, but the permission does not propagate", priv, s.Role, s.EntityPath),
+					fmt.Sprintf("Enable propagation of the permission on %s or assign role %q directly to %s", s.EntityPath, s.Role, e.object.Name))
+				continue
+			}
+			result.Warn(e.object, fmt.Sprintf("privilege %s is granted by role %q on %s, but the permission is overridden by a permission closer to the entity", priv, s.Role, s.EntityPath),
+				fmt.Sprintf("Add privilege %s to the role of the overriding permission or remove the permission", priv))
+		}
+	}
+}
+
+// describePermission describes a permission. effective is true when the
+// permission defines privileges of the user on the entity.
+func describePermission(s *vmware.PermissionSource, effective bool) string {
+	principal := "user " + s.Principal
+	if s.Group {
+		principal = "group " + s.Principal
+	}
+	if s.Unverified {
+		principal += " (membership unverified)"
+	}
+	how := "assigned directly"
+	switch {
+	case s.Inherited && !s.Propagate:
+		how = "not propagated, does not apply"
+	case !effective && !s.Unverified:
+		how = "overridden, does not apply"
+	case s.Inherited:
+		how = "propagated"
+	}
+	return fmt.Sprintf("role %q of %s on %s (%s)", s.Role, principal, s.EntityPath, how)
+}
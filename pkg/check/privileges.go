@@ -0,0 +1,320 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+)
+
+// requiredPrivileges are privileges OpenShift needs on each kind of vSphere entity,
+// as documented in OpenShift installation documentation.
+var requiredPrivileges = map[ObjectKind][]string{
+	// vCenter root folder. StorageProfile privileges are needed to use storage policies.
+	KindVCenter: {
+		"Cns.Searchable",
+		"InventoryService.Tagging.AttachTag",
+		"InventoryService.Tagging.CreateCategory",
+		"InventoryService.Tagging.CreateTag",
+		"InventoryService.Tagging.DeleteCategory",
+		"InventoryService.Tagging.DeleteTag",
+		"InventoryService.Tagging.EditCategory",
+		"InventoryService.Tagging.EditTag",
+		"Sessions.ValidateSession",
+		"StorageProfile.Update",
+		"StorageProfile.View",
+	},
+	KindDatacenter: {
+		"System.Anonymous",
+		"System.Read",
+		"System.View",
+	},
+	KindCluster: {
+		"Host.Config.Storage",
+		"Resource.AssignVMToPool",
+		"VApp.AssignResourcePool",
+		"VApp.Import",
+		"VirtualMachine.Config.AddNewDisk",
+	},
+	KindResourcePool: {
+		"Resource.AssignVMToPool",
+		"VApp.AssignResourcePool",
+		"VApp.Import",
+		"VirtualMachine.Config.AddNewDisk",
+	},
+	KindDatastore: {
+		"Datastore.AllocateSpace",
+		"Datastore.Browse",
+		"Datastore.FileManagement",
+		"InventoryService.Tagging.ObjectAttachable",
+	},
+	KindNetwork: {
+		"Network.Assign",
+	},
+	KindFolder:         vmPrivileges,
+	KindVirtualMachine: vmPrivileges,
+}
+
+// vmPrivileges are privileges needed on VMs and their folder.
+var vmPrivileges = []string{
+	"Resource.AssignVMToPool",
+	"VApp.Import",
+	"VirtualMachine.Config.AddExistingDisk",
+	"VirtualMachine.Config.AddNewDisk",
+	"VirtualMachine.Config.AddRemoveDevice",
+	"VirtualMachine.Config.AdvancedConfig",
+	"VirtualMachine.Config.Annotation",
+	"VirtualMachine.Config.CPUCount",
+	"VirtualMachine.Config.DiskExtend",
+	"VirtualMachine.Config.DiskLease",
+	"VirtualMachine.Config.EditDevice",
+	"VirtualMachine.Config.Memory",
+	"VirtualMachine.Config.RemoveDisk",
+	"VirtualMachine.Config.Rename",
+	"VirtualMachine.Config.ResetGuestInfo",
+	"VirtualMachine.Config.Resource",
+	"VirtualMachine.Config.Settings",
+	"VirtualMachine.Config.UpgradeVirtualHardware",
+	"VirtualMachine.Interact.GuestControl",
+	"VirtualMachine.Interact.PowerOff",
+	"VirtualMachine.Interact.PowerOn",
+	"VirtualMachine.Interact.Reset",
+	"VirtualMachine.Inventory.Create",
+	"VirtualMachine.Inventory.CreateFromExisting",
+	"VirtualMachine.Inventory.Delete",
+	"VirtualMachine.Provisioning.Clone",
+	"VirtualMachine.Provisioning.DeployTemplate",
+	"VirtualMachine.Provisioning.MarkAsTemplate",
+}
+
+// RequiredPrivileges returns privileges OpenShift needs on given kind of vSphere entity.
+func RequiredPrivileges(kind ObjectKind) []string {
+	return requiredPrivileges[kind]
+}
+
+// entity is a vSphere entity used by the cluster.
+type entity struct {
+	// object identifies the entity in findings, with its inventory path as the name.
+	object Object
+	ref    types.ManagedObjectReference
+	// vc is the vCenter of the entity.
+	vc *vmware.VCenter
+}
+
+// CheckPrivileges tests that the vCenter user has all privileges OpenShift
+// needs on all entities used by the cluster, in the vCenter of each entity.
+func CheckPrivileges(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+	klog.V(4).Infof("CheckPrivileges started")
+	if !checkCtx.hasVCenterSession() {
+		return checkCtx.noVCenterResult(), nil
+	}
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
+	entities := checkCtx.getClusterEntities(ctx, result)
+	missingPrivileges := make([][]string, len(entities))
+	errs := make([]error, len(entities))
+	err := checkCtx.parallelize(ctx, len(entities), func(i int) {
+		missingPrivileges[i], errs[i] = vmware.MissingPrivileges(ctx, entities[i].vc, entities[i].ref, requiredPrivileges[entities[i].object.Kind])
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entities {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		missing := missingPrivileges[i]
+		if len(missing) == 0 {
+			klog.V(4).Infof("%s has all required privileges", e.object)
+			continue
+		}
+		result.Add(Finding{
+			Severity:   StatusFail,
+			Object:     e.object,
+			Message:    fmt.Sprintf("missing privileges: %s", strings.Join(missing, ", ")),
+			Fix:        fmt.Sprintf("Grant the vCenter user the missing privileges on %s %s", e.object.Kind, e.object.Name),
+			Privileges: missing,
+		})
+	}
+	result.Message = fmt.Sprintf("privileges on %d entities checked", len(entities))
+	klog.V(4).Infof("CheckPrivileges finished, %d entities checked", len(entities))
+	return result, nil
+}
+
+// getClusterEntities returns all entities that are used by the cluster: the
+// root folder, the datacenter, the cluster, the resource pool, the default
+// datastore, the VM folder and the network in the default vCenter and the
+// root folder and all configured datacenters of the other vCenters.
+// Entities that cannot be found are reported as failed findings. The
+// entities are resolved on the first call and shared by all checks.
+func (c *CheckContext) getClusterEntities(ctx context.Context, result *Result) []entity {
+	c.entitiesOnce.Do(func() {
+		r := NewResult()
+		defaultVC := c.DefaultVCenter()
+		for _, e := range findClusterEntities(ctx, defaultVC, c.VMConfig, r) {
+			e.vc = defaultVC
+			c.entities = append(c.entities, e)
+		}
+		for _, vc := range c.VCenters {
+			if vc != defaultVC {
+				c.entities = append(c.entities, findVCenterEntities(ctx, vc, r)...)
+			}
+		}
+		c.entityFindings = r.Findings
+	})
+	for _, f := range c.entityFindings {
+		result.Add(f)
+	}
+	// Callers append to the slice, don't share its backing array.
+	return append([]entity(nil), c.entities...)
+}
+
+func findClusterEntities(ctx context.Context, vc *vmware.VCenter, config *vmware.Config, result *Result) []entity {
+	ctx, cancel := context.WithTimeout(ctx, *vmware.Timeout)
+	defer cancel()
+
+	entities := []entity{
+		{
+			object: Object{Kind: KindVCenter, Name: "/"},
+			ref:    vc.Client.ServiceContent.RootFolder,
+		},
+	}
+
+	finder := find.NewFinder(vc.Client.Client, false)
+	dc, err := finder.Datacenter(ctx, config.Workspace.Datacenter)
+	if err != nil {
+		result.Fail(Object{Kind: KindDatacenter, Name: config.Workspace.Datacenter}, fmt.Sprintf("failed to access Datacenter: %s", err), "Make sure the datacenter exists and the vCenter user has permissions to access it")
+		return entities
+	}
+	finder.SetDatacenter(dc)
+	entities = append(entities, entity{
+		object: Object{Kind: KindDatacenter, Name: dc.InventoryPath},
+		ref:    dc.Reference(),
+	})
+
+	notFound := func(kind ObjectKind, name string, err error) {
+		result.Fail(Object{Kind: kind, Name: name}, fmt.Sprintf("failed to access %s: %s", kind, err), fmt.Sprintf("Make sure the %s exists and the vCenter user has permissions to access it", kind))
+	}
+
+	if name := config.Workspace.ResourcePoolPath; name != "" {
+		pool, err := finder.ResourcePool(ctx, name)
+		if err != nil {
+			notFound(KindResourcePool, name, err)
+		} else {
+			entities = append(entities, entity{
+				object: Object{Kind: KindResourcePool, Name: pool.InventoryPath},
+				ref:    pool.Reference(),
+			})
+			if cluster, err := getPoolOwner(ctx, pool); err != nil {
+				notFound(KindCluster, pool.InventoryPath, err)
+			} else {
+				entities = append(entities, *cluster)
+			}
+		}
+	}
+
+	if name := config.Workspace.DefaultDatastore; name != "" {
+		ds, err := finder.Datastore(ctx, name)
+		if err != nil {
+			notFound(KindDatastore, name, err)
+		} else {
+			entities = append(entities, entity{
+				object: Object{Kind: KindDatastore, Name: ds.InventoryPath},
+				ref:    ds.Reference(),
+			})
+		}
+	}
+
+	if name := config.Workspace.Folder; name != "" {
+		folder, err := finder.Folder(ctx, name)
+		if err != nil {
+			notFound(KindFolder, name, err)
+		} else {
+			entities = append(entities, entity{
+				object: Object{Kind: KindFolder, Name: folder.InventoryPath},
+				ref:    folder.Reference(),
+			})
+		}
+	}
+
+	if name := config.Network.PublicNetwork; name != "" {
+		network, err := finder.Network(ctx, name)
+		if err != nil {
+			notFound(KindNetwork, name, err)
+		} else {
+			entities = append(entities, entity{
+				object: Object{Kind: KindNetwork, Name: networkPath(network, name)},
+				ref:    network.Reference(),
+			})
+		}
+	}
+	return entities
+}
+
+// findVCenterEntities returns the root folder and all configured datacenters
+// of a vCenter other than the default one.
+func findVCenterEntities(ctx context.Context, vc *vmware.VCenter, result *Result) []entity {
+	server := vc.Config.Server
+	entities := []entity{
+		{
+			object: Object{Kind: KindVCenter, Name: "/", VCenter: server},
+			ref:    vc.Client.ServiceContent.RootFolder,
+			vc:     vc,
+		},
+	}
+	dcs, err := vmware.GetDatacenters(ctx, vc)
+	if err != nil {
+		result.Fail(Object{Kind: KindVCenter, Name: "/", VCenter: server}, err.Error(), "Make sure the datacenters exist and the vCenter user has permissions to access them")
+		return entities
+	}
+	for _, dc := range dcs {
+		entities = append(entities, entity{
+			object: Object{Kind: KindDatacenter, Name: dc.InventoryPath, VCenter: server},
+			ref:    dc.Reference(),
+			vc:     vc,
+		})
+	}
+	return entities
+}
+
+// getPoolOwner returns the cluster (or standalone host) that owns the resource pool.
+func getPoolOwner(ctx context.Context, pool *object.ResourcePool) (*entity, error) {
+	var p mo.ResourcePool
+	if err := pool.Properties(ctx, pool.Reference(), []string{"owner"}, &p); err != nil {
+		return nil, err
+	}
+	// Resource pools are always under "<cluster path>/Resources".
+	path := pool.InventoryPath
+	if i := strings.Index(path, "/Resources"); i > 0 {
+		path = path[:i]
+	} else {
+		name, err := object.NewCommon(pool.Client(), p.Owner).ObjectName(ctx)
+		if err != nil {
+			return nil, err
+		}
+		path = name
+	}
+	return &entity{
+		object: Object{Kind: KindCluster, Name: path},
+		ref:    p.Owner,
+	}, nil
+}
+
+// networkPath returns inventory path of a network, or the default when it's not known.
+func networkPath(network object.NetworkReference, defaultPath string) string {
+	switch n := network.(type) {
+	case *object.Network:
+		return n.InventoryPath
+	case *object.DistributedVirtualPortgroup:
+		return n.InventoryPath
+	case *object.OpaqueNetwork:
+		return n.InventoryPath
+	}
+	return defaultPath
+}
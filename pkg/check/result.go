@@ -0,0 +1,168 @@
+package check
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Status is the outcome of a check and severity of a finding.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+	// StatusInfo is used only for informative findings, it does not
+	// affect status of a check.
+	StatusInfo Status = "info"
+	// StatusError is used when a check could not be performed, e.g. when
+	// an API call failed. It is more severe than StatusFail.
+	StatusError Status = "error"
+)
+
+// ObjectKind is kind of an object affected by a finding.
+type ObjectKind string
+
+const (
+	KindNode              ObjectKind = "Node"
+	KindStorageClass      ObjectKind = "StorageClass"
+	KindPV                ObjectKind = "PersistentVolume"
+	KindConfigMap         ObjectKind = "ConfigMap"
+	KindSecret            ObjectKind = "Secret"
+	KindMachineConfig     ObjectKind = "MachineConfig"
+	KindMachineConfigPool ObjectKind = "MachineConfigPool"
+	KindDatastore         ObjectKind = "Datastore"
+	KindStoragePolicy     ObjectKind = "StoragePolicy"
+	KindVCenter           ObjectKind = "vCenter"
+	KindDatacenter        ObjectKind = "Datacenter"
+	KindFolder            ObjectKind = "Folder"
+	KindCluster           ObjectKind = "Cluster"
+	KindResourcePool      ObjectKind = "ResourcePool"
+	KindNetwork           ObjectKind = "Network"
+	KindVirtualMachine    ObjectKind = "VirtualMachine"
+)
+
+// Object identifies a Kubernetes or vSphere object affected by a finding.
+type Object struct {
+	Kind ObjectKind `json:"kind,omitempty"`
+	Name string     `json:"name,omitempty"`
+	// VCenter is server of the vCenter of a vSphere object. It's empty for
+	// objects in the default vCenter and for Kubernetes objects.
+	VCenter string `json:"vCenter,omitempty"`
+}
+
+// String returns kind and name of the object, with its vCenter when it's
+// not the default one.
+func (o Object) String() string {
+	s := fmt.Sprintf("%s %q", o.Kind, o.Name)
+	if o.VCenter != "" {
+		s += " in vCenter " + o.VCenter
+	}
+	return s
+}
+
+// Finding is a single issue found by a check.
+type Finding struct {
+	// Severity of the finding, either StatusInfo, StatusWarn, StatusFail
+	// or StatusError.
+	Severity Status `json:"severity"`
+	// Object affected by the finding.
+	Object Object `json:"object"`
+	// Message describes the issue.
+	Message string `json:"message"`
+	// Fix is a suggested fix of the issue.
+	Fix string `json:"fix,omitempty"`
+	// Privileges are IDs of vCenter privileges related to the finding,
+	// e.g. privileges missing on the object.
+	Privileges []string `json:"privileges,omitempty"`
+}
+
+// Result is result of a single check.
+type Result struct {
+	// Status is the overall status of the check. It's the most severe
+	// status of all findings, StatusPass when there are no findings or
+	// StatusSkip when the check was skipped.
+	Status Status `json:"status"`
+	// Message is a short summary of the check, e.g. how many objects were checked.
+	Message string `json:"message,omitempty"`
+	// Findings are all issues found by the check.
+	Findings []Finding `json:"findings,omitempty"`
+
+	// mu protects Status and Findings, a check may add findings from parallel workers.
+	mu sync.Mutex
+}
+
+// NewResult returns a new passing result.
+func NewResult() *Result {
+	return &Result{
+		Status: StatusPass,
+	}
+}
+
+// SkippedResult returns a result of a check that was not run.
+func SkippedResult(reason string) *Result {
+	return &Result{
+		Status:  StatusSkip,
+		Message: reason,
+	}
+}
+
+// Fail adds a failed finding to the result.
+func (r *Result) Fail(object Object, message, fix string) {
+	r.add(StatusFail, object, message, fix)
+}
+
+// Warn adds a warning to the result.
+func (r *Result) Warn(object Object, message, fix string) {
+	r.add(StatusWarn, object, message, fix)
+}
+
+// Info adds an informative finding to the result.
+func (r *Result) Info(object Object, message string) {
+	r.add(StatusInfo, object, message, "")
+}
+
+func (r *Result) add(severity Status, object Object, message, fix string) {
+	r.Add(Finding{
+		Severity: severity,
+		Object:   object,
+		Message:  message,
+		Fix:      fix,
+	})
+}
+
+// Add adds a finding to the result.
+func (r *Result) Add(finding Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Findings = append(r.Findings, finding)
+	if finding.Severity.WorseThan(r.Status) {
+		r.Status = finding.Severity
+	}
+}
+
+// Merge adds all findings of other result to the result.
+func (r *Result) Merge(other *Result) {
+	for _, finding := range other.Findings {
+		r.Add(finding)
+	}
+}
+
+// WorseThan returns true if s is more severe than other.
+func (s Status) WorseThan(other Status) bool {
+	return s.severity() > other.severity()
+}
+
+func (s Status) severity() int {
+	switch s {
+	case StatusWarn:
+		return 1
+	case StatusFail:
+		return 2
+	case StatusError:
+		return 3
+	default:
+		return 0
+	}
+}
@@ -5,39 +5,56 @@ import (
 	"fmt"
 
 	"github.com/jsafrane/vmware-check/pkg/vmware"
-	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/view"
 	"github.com/vmware/govmomi/vim25/types"
 	"k8s.io/klog/v2"
 )
 
-// CheckFolderList tests that OCP has permissions to list volumes in Datastore.
-// This is necessary to create volumes.
-func CheckTaskPermissions(vmClient *govmomi.Client) error {
+// CheckTaskPermissions tests that OCP has permissions to list tasks in all vCenters.
+func CheckTaskPermissions(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
 	klog.V(4).Infof("CheckTaskPermissions started")
+	if !checkCtx.hasVCenterSession() {
+		return checkCtx.noVCenterResult(), nil
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), *vmware.Timeout)
+	result := NewResult()
+	checkCtx.addVCenterErrors(result)
+	taskCount := 0
+	for _, vc := range checkCtx.VCenters {
+		count, err := countTasks(ctx, vc)
+		if err != nil {
+			result.Fail(Object{Kind: KindVCenter, Name: vc.Config.Server}, err.Error(), "Grant the vCenter user permissions to read tasks")
+			continue
+		}
+		taskCount += count
+	}
+	result.Message = fmt.Sprintf("%d tasks found in %d vCenters", taskCount, len(checkCtx.VCenters))
+	klog.V(4).Infof("CheckTaskPermissions finished, %d tasks found", taskCount)
+	return result, nil
+}
+
+func countTasks(ctx context.Context, vc *vmware.VCenter) (int, error) {
+	vmClient := vc.Client
+	callCtx, cancel := context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
 
 	mgr := view.NewManager(vmClient.Client)
-	view, err := mgr.CreateTaskView(ctx, vmClient.ServiceContent.TaskManager)
+	view, err := mgr.CreateTaskView(callCtx, vmClient.ServiceContent.TaskManager)
 	if err != nil {
-		return fmt.Errorf("error creating task view: %s", err)
+		return 0, fmt.Errorf("error creating task view: %s", err)
 	}
 
 	taskCount := 0
-	ctx, cancel = context.WithTimeout(context.Background(), *vmware.Timeout)
+	callCtx, cancel = context.WithTimeout(ctx, *vmware.Timeout)
 	defer cancel()
-	err = view.Collect(ctx, func(tasks []types.TaskInfo) {
+	err = view.Collect(callCtx, func(tasks []types.TaskInfo) {
 		for _, task := range tasks {
-			klog.V(4).Infof("Found task %s", task.Name)
+			klog.V(4).Infof("Found task %s in vCenter %s", task.Name, vc.Config.Server)
 			taskCount++
 		}
 	})
-
 	if err != nil {
-		return fmt.Errorf("error collecting tasks: %s", err)
+		return 0, fmt.Errorf("error collecting tasks: %s", err)
 	}
-	klog.Infof("CheckTaskPermissions succeeded, %d tasks found", taskCount)
-	return nil
+	return taskCount, nil
 }
@@ -0,0 +1,99 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	toolsFix = "Install and start VMware Tools (open-vm-tools) in the node's guest OS"
+	hostFix  = "Set hostname of the node's guest OS to the Node name"
+)
+
+// CheckVMwareTools tests that VMware Tools run in VMs of all nodes and are
+// up to date. The cloud provider gets node addresses from VMware Tools,
+// so it checks that the tools report the node's IP addresses and a hostname
+// that matches the Node name.
+func CheckVMwareTools(ctx context.Context, checkCtx *CheckContext) (*Result, error) {
+	klog.V(4).Infof("CheckVMwareTools started")
+	if checkCtx.KubeClient == nil {
+		return SkippedResult(noKubernetesReason), nil
+	}
+
+	result, err := checkCtx.checkNodes(ctx, checkNodeTools)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(4).Infof("CheckVMwareTools finished, %s", result.Message)
+	return result, nil
+}
+
+// checkNodeTools checks VMware Tools of a single node. Nodes whose VMs
+// cannot be found are skipped, they're reported by CheckNodes.
+func checkNodeTools(vms *vmIndex, node *v1.Node, result *Result) {
+	if node.Spec.ProviderID == "" {
+		return
+	}
+	vm, err := vms.getNodeVM(node)
+	if err != nil {
+		klog.V(2).Infof("Skipping VMware Tools of node %q: %s", node.Name, err)
+		return
+	}
+
+	object := Object{Kind: KindNode, Name: node.Name}
+	// The tools also run while they execute power operation scripts in the guest.
+	switch status := types.VirtualMachineToolsRunningStatus(vm.vm.ToolsRunningStatus); status {
+	case types.VirtualMachineToolsRunningStatusGuestToolsRunning,
+		types.VirtualMachineToolsRunningStatusGuestToolsExecutingScripts:
+	default:
+		if status == "" {
+			status = "unknown"
+		}
+		result.Fail(object, fmt.Sprintf("VMware Tools are not running in the node's VM (status %q)", status), toolsFix)
+		// Guest info is not up to date without running tools.
+		return
+	}
+
+	switch types.VirtualMachineToolsVersionStatus(vm.vm.ToolsVersionStatus) {
+	case types.VirtualMachineToolsVersionStatusGuestToolsNeedUpgrade,
+		types.VirtualMachineToolsVersionStatusGuestToolsSupportedOld:
+		result.Warn(object, fmt.Sprintf("VMware Tools in the node's VM are out of date (status %q)", vm.vm.ToolsVersionStatus), "Upgrade VMware Tools in the node's guest OS")
+	case types.VirtualMachineToolsVersionStatusGuestToolsTooOld,
+		types.VirtualMachineToolsVersionStatusGuestToolsBlacklisted:
+		result.Fail(object, fmt.Sprintf("VMware Tools in the node's VM are not supported (status %q)", vm.vm.ToolsVersionStatus), "Upgrade VMware Tools in the node's guest OS")
+	}
+
+	switch {
+	case vm.vm.GuestHostName == "":
+		result.Warn(object, "VMware Tools report no hostname of the node's guest OS", hostFix)
+	case !hostnameMatches(node.Name, vm.vm.GuestHostName):
+		result.Warn(object, fmt.Sprintf("the node's guest hostname %q does not match the Node name", vm.vm.GuestHostName), hostFix)
+	}
+	if len(vm.vm.GuestIPAddresses) == 0 {
+		result.Warn(object, "VMware Tools report no IP addresses of the node's VM", "Make sure the node's network interfaces are up and VMware Tools run in the guest OS")
+	}
+	klog.V(4).Infof("... the node's VM has VMware Tools %s, hostname %q and addresses %v", vm.vm.ToolsVersionStatus, vm.vm.GuestHostName, vm.vm.GuestIPAddresses)
+}
+
+// hostnameMatches returns true when the guest hostname is the Node name.
+// A short hostname matches the first label of a fully qualified name
+// and vice versa. An empty hostname does not match any Node name.
+func hostnameMatches(nodeName, hostName string) bool {
+	if hostName == "" {
+		return false
+	}
+	if strings.EqualFold(nodeName, hostName) {
+		return true
+	}
+	if strings.Contains(nodeName, ".") && strings.Contains(hostName, ".") {
+		return false
+	}
+	nodeShort := strings.SplitN(nodeName, ".", 2)[0]
+	hostShort := strings.SplitN(hostName, ".", 2)[0]
+	return strings.EqualFold(nodeShort, hostShort)
+}
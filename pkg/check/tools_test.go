@@ -0,0 +1,176 @@
+package check
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckNodeTools(t *testing.T) {
+	tests := []struct {
+		name           string
+		runningStatus  string
+		versionStatus  string
+		expectedStatus Status
+	}{
+		{
+			name:           "running and current",
+			runningStatus:  "guestToolsRunning",
+			versionStatus:  "guestToolsCurrent",
+			expectedStatus: StatusPass,
+		},
+		{
+			name:           "executing scripts",
+			runningStatus:  "guestToolsExecutingScripts",
+			versionStatus:  "guestToolsCurrent",
+			expectedStatus: StatusPass,
+		},
+		{
+			name:           "not running",
+			runningStatus:  "guestToolsNotRunning",
+			versionStatus:  "guestToolsCurrent",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "unknown running status",
+			versionStatus:  "guestToolsCurrent",
+			expectedStatus: StatusFail,
+		},
+		{
+			name:           "out of date",
+			runningStatus:  "guestToolsRunning",
+			versionStatus:  "guestToolsNeedUpgrade",
+			expectedStatus: StatusWarn,
+		},
+		{
+			name:           "too old",
+			runningStatus:  "guestToolsRunning",
+			versionStatus:  "guestToolsTooOld",
+			expectedStatus: StatusFail,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inv := &vmware.Inventory{
+				Datacenters: []*vmware.InventoryDatacenter{
+					{
+						InventoryObject: vmware.InventoryObject{Name: "DC0"},
+						VMs: []vmware.InventoryVM{
+							{
+								InventoryObject:    vmware.InventoryObject{Name: "node-0"},
+								BIOSUUID:           "vm-0",
+								ToolsRunningStatus: test.runningStatus,
+								ToolsVersionStatus: test.versionStatus,
+								GuestHostName:      "node-0",
+								GuestIPAddresses:   []string{"10.0.0.10"},
+							},
+						},
+					},
+				},
+			}
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-0"},
+				Spec:       v1.NodeSpec{ProviderID: "vsphere://vm-0"},
+			}
+			result := NewResult()
+			checkNodeTools(buildVMIndex(inv), node, result)
+			if result.Status != test.expectedStatus {
+				t.Errorf("expected status %s, got %s: %+v", test.expectedStatus, result.Status, result.Findings)
+			}
+		})
+	}
+}
+
+func TestCheckNodeToolsGuestInfo(t *testing.T) {
+	tests := []struct {
+		name             string
+		nodeName         string
+		hostName         string
+		ipAddresses      []string
+		expectedMessages []string
+	}{
+		{
+			name:        "same hostname",
+			nodeName:    "node-0",
+			hostName:    "node-0",
+			ipAddresses: []string{"10.0.0.10"},
+		},
+		{
+			name:        "FQDN Node name and short hostname",
+			nodeName:    "node-0.example.com",
+			hostName:    "node-0",
+			ipAddresses: []string{"10.0.0.10"},
+		},
+		{
+			name:        "short Node name and FQDN hostname",
+			nodeName:    "node-0",
+			hostName:    "NODE-0.example.com",
+			ipAddresses: []string{"10.0.0.10"},
+		},
+		{
+			name:             "different FQDNs",
+			nodeName:         "node-0.example.com",
+			hostName:         "node-0.example.org",
+			ipAddresses:      []string{"10.0.0.10"},
+			expectedMessages: []string{`the node's guest hostname "node-0.example.org" does not match the Node name`},
+		},
+		{
+			name:             "different short names",
+			nodeName:         "node-0",
+			hostName:         "localhost",
+			ipAddresses:      []string{"10.0.0.10"},
+			expectedMessages: []string{`the node's guest hostname "localhost" does not match the Node name`},
+		},
+		{
+			name:             "empty hostname",
+			nodeName:         "node-0",
+			ipAddresses:      []string{"10.0.0.10"},
+			expectedMessages: []string{"VMware Tools report no hostname of the node's guest OS"},
+		},
+		{
+			name:             "no guest IPs",
+			nodeName:         "node-0",
+			hostName:         "node-0",
+			expectedMessages: []string{"VMware Tools report no IP addresses of the node's VM"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inv := &vmware.Inventory{
+				Datacenters: []*vmware.InventoryDatacenter{
+					{
+						InventoryObject: vmware.InventoryObject{Name: "DC0"},
+						VMs: []vmware.InventoryVM{
+							{
+								InventoryObject:    vmware.InventoryObject{Name: "node-0"},
+								BIOSUUID:           "vm-0",
+								ToolsRunningStatus: "guestToolsRunning",
+								ToolsVersionStatus: "guestToolsCurrent",
+								GuestHostName:      test.hostName,
+								GuestIPAddresses:   test.ipAddresses,
+							},
+						},
+					},
+				},
+			}
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: test.nodeName},
+				Spec:       v1.NodeSpec{ProviderID: "vsphere://vm-0"},
+			}
+			result := NewResult()
+			checkNodeTools(buildVMIndex(inv), node, result)
+			var messages []string
+			for _, f := range result.Findings {
+				messages = append(messages, f.Message)
+			}
+			if !reflect.DeepEqual(messages, test.expectedMessages) {
+				t.Errorf("expected findings %q, got %q", test.expectedMessages, messages)
+			}
+		})
+	}
+}
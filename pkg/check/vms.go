@@ -0,0 +1,69 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// nodeVM is a VM from the inventory together with its datacenter.
+type nodeVM struct {
+	vm *vmware.InventoryVM
+	dc *vmware.InventoryDatacenter
+}
+
+// vmIndex holds all VMs in the inventory, indexed by their BIOS and instance UUIDs.
+type vmIndex struct {
+	byBIOSUUID     map[string]*nodeVM
+	byInstanceUUID map[string]*nodeVM
+}
+
+// getVMIndex returns index of all VMs in the inventory.
+// The index is built on the first call and shared by all checks.
+func (c *CheckContext) getVMIndex(ctx context.Context) (*vmIndex, error) {
+	c.vmsOnce.Do(func() {
+		var inv *vmware.Inventory
+		inv, c.vmsErr = c.GetInventory(ctx)
+		if c.vmsErr == nil {
+			c.vms = buildVMIndex(inv)
+		}
+	})
+	return c.vms, c.vmsErr
+}
+
+func buildVMIndex(inv *vmware.Inventory) *vmIndex {
+	index := &vmIndex{
+		byBIOSUUID:     map[string]*nodeVM{},
+		byInstanceUUID: map[string]*nodeVM{},
+	}
+	for _, dc := range inv.Datacenters {
+		for i := range dc.VMs {
+			vm := &nodeVM{vm: &dc.VMs[i], dc: dc}
+			if vm.vm.BIOSUUID != "" {
+				index.byBIOSUUID[vm.vm.BIOSUUID] = vm
+			}
+			if vm.vm.InstanceUUID != "" {
+				index.byInstanceUUID[vm.vm.InstanceUUID] = vm
+			}
+		}
+	}
+	return index
+}
+
+// getNodeVM returns VM of the node, searched by UUID from its providerID.
+func (index *vmIndex) getNodeVM(node *v1.Node) (*nodeVM, error) {
+	vmUUID := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(node.Spec.ProviderID, "vsphere://")))
+	if vm, found := index.byBIOSUUID[vmUUID]; found {
+		klog.V(4).Infof("... the node's VM %s found in %s", vm.vm.Name, vm.dc.String())
+		return vm, nil
+	}
+	if vm, found := index.byInstanceUUID[vmUUID]; found {
+		klog.V(4).Infof("... the node's VM %s found in %s by instance UUID", vm.vm.Name, vm.dc.String())
+		return vm, nil
+	}
+	return nil, fmt.Errorf("unable to find VM by UUID %s in any configured datacenter", vmUUID)
+}
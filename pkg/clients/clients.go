@@ -18,12 +18,13 @@ import (
 )
 
 type Interface interface {
-	GetInfrastructure() (*ocpv1.Infrastructure, error)
-	GetConfigMap(namespace, name string) (*v1.ConfigMap, error)
-	GetSecret(namespace, name string) (*v1.Secret, error)
-	ListNodes() ([]v1.Node, error)
-	ListStorageClasses() ([]storagev1.StorageClass, error)
-	ListPVs() ([]v1.PersistentVolume, error)
+	GetInfrastructure(ctx context.Context) (*ocpv1.Infrastructure, error)
+	GetConfigMap(ctx context.Context, namespace, name string) (*v1.ConfigMap, error)
+	GetSecret(ctx context.Context, namespace, name string) (*v1.Secret, error)
+	ListNodes(ctx context.Context) ([]v1.Node, error)
+	ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error)
+	ListPVs(ctx context.Context) ([]v1.PersistentVolume, error)
+	GetRenderedMachineConfig(ctx context.Context, pool string) (*MachineConfig, error)
 }
 
 type clients struct {
@@ -79,26 +80,26 @@ func Create() (Interface, error) {
 	}, nil
 }
 
-func (c *clients) GetInfrastructure() (*ocpv1.Infrastructure, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+func (c *clients) GetInfrastructure(ctx context.Context) (*ocpv1.Infrastructure, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
 	return c.ConfigClient.ConfigV1().Infrastructures().Get(ctx, "cluster", metav1.GetOptions{})
 }
 
-func (c *clients) GetConfigMap(namespace, name string) (*v1.ConfigMap, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+func (c *clients) GetConfigMap(ctx context.Context, namespace, name string) (*v1.ConfigMap, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
 	return c.KubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
-func (c *clients) GetSecret(namespace, name string) (*v1.Secret, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+func (c *clients) GetSecret(ctx context.Context, namespace, name string) (*v1.Secret, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
 	return c.KubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
-func (c *clients) ListNodes() ([]v1.Node, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+func (c *clients) ListNodes(ctx context.Context) ([]v1.Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
 	list, err := c.KubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -107,8 +108,8 @@ func (c *clients) ListNodes() ([]v1.Node, error) {
 	return list.Items, nil
 }
 
-func (c *clients) ListStorageClasses() ([]storagev1.StorageClass, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+func (c *clients) ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
 	list, err := c.KubeClient.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -117,8 +118,8 @@ func (c *clients) ListStorageClasses() ([]storagev1.StorageClass, error) {
 	return list.Items, nil
 }
 
-func (c *clients) ListPVs() ([]v1.PersistentVolume, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+func (c *clients) ListPVs(ctx context.Context) ([]v1.PersistentVolume, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
 	list, err := c.KubeClient.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
 	if err != nil {
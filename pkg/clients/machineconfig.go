@@ -0,0 +1,117 @@
+package clients
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// machineConfigAPIPath is the path of machineconfiguration.openshift.io/v1 API.
+	// The API is not vendored, objects are read as JSON.
+	machineConfigAPIPath = "/apis/machineconfiguration.openshift.io/v1"
+)
+
+// MachineConfig is a rendered MachineConfig, with only the files that
+// machine-config-operator writes to nodes.
+type MachineConfig struct {
+	Name  string
+	Files []MachineConfigFile
+}
+
+// MachineConfigFile is a single file in a MachineConfig.
+type MachineConfigFile struct {
+	Path string
+	// Contents is the decoded content of the file. It's empty when the
+	// file is not stored in the MachineConfig as a data URL.
+	Contents string
+}
+
+// machineConfigPool is the part of MachineConfigPool read by the checks.
+type machineConfigPool struct {
+	Status struct {
+		Configuration struct {
+			Name string `json:"name"`
+		} `json:"configuration"`
+	} `json:"status"`
+}
+
+// machineConfig is the part of MachineConfig read by the checks.
+type machineConfig struct {
+	Spec struct {
+		Config struct {
+			Storage struct {
+				Files []struct {
+					Path     string `json:"path"`
+					Contents struct {
+						Source string `json:"source"`
+					} `json:"contents"`
+				} `json:"files"`
+			} `json:"storage"`
+		} `json:"config"`
+	} `json:"spec"`
+}
+
+// GetRenderedMachineConfig returns the rendered MachineConfig that is
+// currently applied to nodes of the MachineConfigPool.
+func (c *clients) GetRenderedMachineConfig(ctx context.Context, pool string) (*MachineConfig, error) {
+	var mcp machineConfigPool
+	if err := c.getMachineConfigObject(ctx, "machineconfigpools", pool, &mcp); err != nil {
+		return nil, err
+	}
+	name := mcp.Status.Configuration.Name
+	if name == "" {
+		return nil, fmt.Errorf("MachineConfigPool %s has no rendered MachineConfig", pool)
+	}
+
+	var mc machineConfig
+	if err := c.getMachineConfigObject(ctx, "machineconfigs", name, &mc); err != nil {
+		return nil, err
+	}
+	rendered := &MachineConfig{Name: name}
+	for _, f := range mc.Spec.Config.Storage.Files {
+		contents, err := decodeDataURL(f.Contents.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode file %s in MachineConfig %s: %s", f.Path, name, err)
+		}
+		rendered.Files = append(rendered.Files, MachineConfigFile{Path: f.Path, Contents: contents})
+	}
+	return rendered, nil
+}
+
+func (c *clients) getMachineConfigObject(ctx context.Context, resource, name string, into interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+	data, err := c.KubeClient.Discovery().RESTClient().Get().AbsPath(machineConfigAPIPath, resource, name).Do(ctx).Raw()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+// decodeDataURL returns content of an Ignition data URL, either percent
+// encoded or base64. It returns "" for sources that are not data URLs.
+func decodeDataURL(source string) (string, error) {
+	if !strings.HasPrefix(source, "data:") {
+		klog.V(4).Infof("Skipping file source %q, it's not a data URL", source)
+		return "", nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "data:"), ",", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("missing ',' in data URL")
+	}
+	mediaType, data := parts[0], parts[1]
+	if strings.HasSuffix(mediaType, ";base64") {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", err
+		}
+		return string(decoded), nil
+	}
+	return url.PathUnescape(data)
+}
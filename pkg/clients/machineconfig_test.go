@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"testing"
+)
+
+func TestDecodeDataURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "percent encoded",
+			source:   "data:,%5BGlobal%5D%0Asecret-name%20%3D%20%22vsphere-creds%22%0A",
+			expected: "[Global]\nsecret-name = \"vsphere-creds\"\n",
+		},
+		{
+			name:     "base64",
+			source:   "data:text/plain;charset=utf-8;base64,W0dsb2JhbF0K",
+			expected: "[Global]\n",
+		},
+		{
+			name:   "not a data URL",
+			source: "https://example.com/cloud.conf",
+		},
+		{
+			name:        "invalid base64",
+			source:      "data:;base64,!!!",
+			expectError: true,
+		},
+		{
+			name:        "missing data",
+			source:      "data:text/plain",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contents, err := decodeDataURL(test.source)
+			if err != nil {
+				if !test.expectError {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if test.expectError {
+				t.Errorf("expected error, got %q", contents)
+			}
+			if contents != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, contents)
+			}
+		})
+	}
+}
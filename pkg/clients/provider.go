@@ -0,0 +1,253 @@
+package clients
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+	ocpv1 "github.com/openshift/api/config/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ProviderAuto       = "auto"
+	ProviderOpenShift  = "openshift"
+	ProviderKubernetes = "kubernetes"
+
+	// openshiftConfigNamespace is namespace of the OpenShift cloud config ConfigMap.
+	openshiftConfigNamespace = "openshift-config"
+
+	// defaultKubernetesClusterID is the default --cluster-name of kube-controller-manager,
+	// used in names of dynamically provisioned volumes.
+	defaultKubernetesClusterID = "kubernetes"
+)
+
+var (
+	providerFlag      = flag.String("provider", ProviderAuto, "Kind of the cluster: openshift, kubernetes or auto to detect it.")
+	cloudConfigMap    = flag.String("cloud-config-configmap", "", "ConfigMap with vSphere cloud provider config in Kubernetes cluster, as <namespace>/<name>. Not used in OpenShift. Well-known cloud provider and CSI driver configs are tried if neither this nor -cloud-config-secret is set. Cannot be used together with -cloud-config-secret.")
+	cloudConfigSecret = flag.String("cloud-config-secret", "", "Secret with vSphere cloud provider or CSI driver config in Kubernetes cluster, as <namespace>/<name>. Not used in OpenShift.")
+	cloudConfigKey    = flag.String("cloud-config-key", "vsphere.conf", "Key of the config in -cloud-config-configmap or -cloud-config-secret.")
+	clusterIDFlag     = flag.String("cluster-id", "", "ID of the cluster, as used in names of dynamically provisioned volumes. Read from the cluster if omitted.")
+)
+
+// configSource is a ConfigMap or Secret with vSphere config.
+type configSource struct {
+	secret    bool
+	namespace string
+	name      string
+	key       string
+}
+
+func (s configSource) String() string {
+	kind := "ConfigMap"
+	if s.secret {
+		kind = "Secret"
+	}
+	return fmt.Sprintf("%s %s/%s", kind, s.namespace, s.name)
+}
+
+// wellKnownConfigSources are default locations of the out-of-tree cloud
+// provider config and of the CSI driver config, in order of preference.
+var wellKnownConfigSources = []configSource{
+	{namespace: "kube-system", name: "cloud-config", key: "vsphere.conf"},
+	{namespace: "kube-system", name: "vsphere-cloud-config", key: "vsphere.conf"},
+	{secret: true, namespace: "vmware-system-csi", name: "vsphere-config-secret", key: "csi-vsphere.conf"},
+	{secret: true, namespace: "kube-system", name: "vsphere-config-secret", key: "csi-vsphere.conf"},
+}
+
+// CloudConfig is vSphere config read from the cluster.
+type CloudConfig struct {
+	// Data is content of the config.
+	Data string
+	// Source describes where the config was read from, e.g. "ConfigMap kube-system/cloud-config".
+	Source string
+	// InSecret is true when the config is stored in a Secret and not in a ConfigMap.
+	InSecret bool
+}
+
+// Provider supplies cluster specific information that is not part of
+// the common Kubernetes API: the vSphere cloud provider config and the cluster ID.
+type Provider interface {
+	// Name returns name of the provider.
+	Name() string
+	// GetCloudConfig returns the vSphere cloud provider config.
+	GetCloudConfig(ctx context.Context) (*CloudConfig, error)
+	// GetClusterID returns ID of the cluster, as used in volume names.
+	GetClusterID(ctx context.Context) (string, error)
+}
+
+// NewProvider returns Provider selected by -provider flag. With "auto",
+// OpenShift is detected by presence of the Infrastructure object.
+func NewProvider(ctx context.Context, c Interface) (Provider, error) {
+	name := *providerFlag
+	if name == ProviderAuto {
+		var err error
+		name, err = detectProvider(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(2).Infof("Detected %s cluster", name)
+	}
+
+	switch name {
+	case ProviderOpenShift:
+		return &openshiftProvider{clients: c}, nil
+	case ProviderKubernetes:
+		return &kubernetesProvider{clients: c}, nil
+	default:
+		return nil, fmt.Errorf("unsupported provider %q, use %q, %q or %q", name, ProviderAuto, ProviderOpenShift, ProviderKubernetes)
+	}
+}
+
+func detectProvider(ctx context.Context, c Interface) (string, error) {
+	_, err := c.GetInfrastructure(ctx)
+	if err == nil {
+		return ProviderOpenShift, nil
+	}
+	if errors.IsNotFound(err) {
+		klog.V(4).Infof("Infrastructure not found: %s", err)
+		return ProviderKubernetes, nil
+	}
+	return "", fmt.Errorf("failed to detect cluster provider: %s", err)
+}
+
+// openshiftProvider reads the config and the cluster ID from OpenShift Infrastructure.
+type openshiftProvider struct {
+	clients Interface
+}
+
+var _ Provider = &openshiftProvider{}
+
+func (p *openshiftProvider) Name() string {
+	return ProviderOpenShift
+}
+
+func (p *openshiftProvider) GetCloudConfig(ctx context.Context) (*CloudConfig, error) {
+	infra, err := p.clients.GetInfrastructure(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Infrastructure: %s", err)
+	}
+	klog.V(4).Infof("Got Infrastructure with Platform %q", infra.Status.PlatformStatus.Type)
+
+	if infra.Status.PlatformStatus.Type != ocpv1.VSpherePlatformType {
+		return nil, fmt.Errorf("unsupported platform: %s", infra.Status.PlatformStatus.Type)
+	}
+
+	src := configSource{namespace: openshiftConfigNamespace, name: infra.Spec.CloudConfig.Name, key: infra.Spec.CloudConfig.Key}
+	cfg, err := getCloudConfig(ctx, p.clients, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster config: %s", err)
+	}
+	return cfg, nil
+}
+
+func (p *openshiftProvider) GetClusterID(ctx context.Context) (string, error) {
+	if *clusterIDFlag != "" {
+		return *clusterIDFlag, nil
+	}
+	infra, err := p.clients.GetInfrastructure(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Infrastructure: %s", err)
+	}
+	return infra.Status.InfrastructureName, nil
+}
+
+// kubernetesProvider reads the config from a ConfigMap or a Secret given by
+// flags and the cluster ID from -cluster-id.
+type kubernetesProvider struct {
+	clients Interface
+}
+
+var _ Provider = &kubernetesProvider{}
+
+func (p *kubernetesProvider) Name() string {
+	return ProviderKubernetes
+}
+
+func (p *kubernetesProvider) GetCloudConfig(ctx context.Context) (*CloudConfig, error) {
+	var flagSource, flagValue string
+	src := configSource{key: *cloudConfigKey}
+	switch {
+	case *cloudConfigSecret != "" && *cloudConfigMap != "":
+		return nil, fmt.Errorf("-cloud-config-secret and -cloud-config-configmap cannot be used together")
+	case *cloudConfigSecret != "":
+		flagSource, flagValue = "-cloud-config-secret", *cloudConfigSecret
+		src.secret = true
+	case *cloudConfigMap != "":
+		flagSource, flagValue = "-cloud-config-configmap", *cloudConfigMap
+	default:
+		return p.detectCloudConfig(ctx)
+	}
+
+	var err error
+	src.namespace, src.name, err = splitNamespacedName(flagValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", flagSource, err)
+	}
+	return getCloudConfig(ctx, p.clients, src)
+}
+
+// detectCloudConfig returns the config from the first well-known location that exists.
+func (p *kubernetesProvider) detectCloudConfig(ctx context.Context) (*CloudConfig, error) {
+	var tried []string
+	for _, src := range wellKnownConfigSources {
+		cfg, err := getCloudConfig(ctx, p.clients, src)
+		if err == nil {
+			klog.V(2).Infof("Using config from %s", src)
+			return cfg, nil
+		}
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		klog.V(4).Infof("%s not found", src)
+		tried = append(tried, src.String())
+	}
+	return nil, fmt.Errorf("no vSphere config found in %s, use -cloud-config-configmap, -cloud-config-secret or -vmware-config", strings.Join(tried, ", "))
+}
+
+func (p *kubernetesProvider) GetClusterID(ctx context.Context) (string, error) {
+	if *clusterIDFlag != "" {
+		return *clusterIDFlag, nil
+	}
+	klog.V(2).Infof("No -cluster-id specified, using default %q", defaultKubernetesClusterID)
+	return defaultKubernetesClusterID, nil
+}
+
+// getCloudConfig reads the config from the ConfigMap or Secret.
+func getCloudConfig(ctx context.Context, c Interface, src configSource) (*CloudConfig, error) {
+	if src.secret {
+		secret, err := c.GetSecret(ctx, src.namespace, src.name)
+		if err != nil {
+			return nil, err
+		}
+		data, found := secret.Data[src.key]
+		if !found {
+			return nil, fmt.Errorf("cluster config %s does not contain key %s", src, src.key)
+		}
+		// The config in a Secret contains credentials, do not log it, even redacted.
+		klog.V(4).Infof("Got %s with config", src)
+		return &CloudConfig{Data: string(data), Source: src.String(), InSecret: true}, nil
+	}
+
+	configMap, err := c.GetConfigMap(ctx, src.namespace, src.name)
+	if err != nil {
+		return nil, err
+	}
+	cfgString, found := configMap.Data[src.key]
+	if !found {
+		return nil, fmt.Errorf("cluster config %s does not contain key %s", src, src.key)
+	}
+	klog.V(4).Infof("Got %s with config:\n%s", src, vmware.RedactConfig(cfgString))
+	return &CloudConfig{Data: cfgString, Source: src.String()}, nil
+}
+
+func splitNamespacedName(s string) (string, string, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("expected <namespace>/<name>, got %q", s)
+	}
+	return parts[0], parts[1], nil
+}
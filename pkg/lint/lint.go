@@ -0,0 +1,238 @@
+package lint
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/check"
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+)
+
+// KindConfigKey is kind of findings about config keys. Name of the object is
+// "<section> <key>", e.g. `VirtualCenter "vcenter.example.com" port`.
+const KindConfigKey check.ObjectKind = "ConfigKey"
+
+// Options of the linter.
+type Options struct {
+	// InConfigMap is true when the config is stored in a ConfigMap, i.e.
+	// readable by anyone who can read ConfigMaps in its namespace.
+	InConfigMap bool
+}
+
+// Lint checks the vSphere config for deprecated, inconsistent and insecure
+// values. It does not connect anywhere.
+func Lint(cfg *vmware.Config, opts Options) *check.Result {
+	result := check.NewResult()
+	lintDeprecated(cfg, result)
+	lintWorkspace(cfg, result)
+	lintCredentials(cfg, opts, result)
+	lintTLS(cfg, result)
+	lintServers(cfg, result)
+	result.Message = fmt.Sprintf("%d issues found", len(result.Findings))
+	return result
+}
+
+func key(section, name string) check.Object {
+	return check.Object{Kind: KindConfigKey, Name: section + " " + name}
+}
+
+func vcSection(server string) string {
+	return fmt.Sprintf("VirtualCenter %q", server)
+}
+
+// sortedServers returns names of all VirtualCenter sections.
+func sortedServers(cfg *vmware.Config) []string {
+	var servers []string
+	for server := range cfg.VirtualCenter {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+func lintDeprecated(cfg *vmware.Config, result *check.Result) {
+	if cfg.Global.Datacenter != "" {
+		result.Warn(key("Global", "datacenter"), "deprecated key is set", "Use Global datacenters or datacenters of VirtualCenter sections")
+	}
+	if cfg.Global.DefaultDatastore != "" {
+		result.Warn(key("Global", "datastore"), "deprecated key is set", "Use Workspace default-datastore")
+	}
+	if cfg.Global.WorkingDir != "" {
+		result.Warn(key("Global", "working-dir"), "deprecated key is set", "Use Workspace folder")
+	}
+	if cfg.Global.VCenterIP != "" {
+		result.Warn(key("Global", "server"), "deprecated key is set", "Use a VirtualCenter section for each vCenter")
+	}
+}
+
+func lintWorkspace(cfg *vmware.Config, result *check.Result) {
+	if len(cfg.VirtualCenter) == 0 {
+		// The old format without VirtualCenter sections, nothing to match.
+		return
+	}
+	server := cfg.Workspace.VCenterIP
+	if server == "" {
+		result.Fail(key("Workspace", "server"), "key is not set", "Set Workspace server to the vCenter where volumes are created")
+		return
+	}
+	if _, found := cfg.VirtualCenter[server]; !found {
+		result.Fail(key("Workspace", "server"), fmt.Sprintf("%q does not match any VirtualCenter section", server),
+			fmt.Sprintf("Use one of: %s", strings.Join(sortedServers(cfg), ", ")))
+		return
+	}
+
+	dc := cfg.Workspace.Datacenter
+	if dc == "" {
+		result.Fail(key("Workspace", "datacenter"), "key is not set", "Set Workspace datacenter to the datacenter where volumes are created")
+		return
+	}
+	datacenters := cfg.Global.Datacenters
+	if datacenters == "" {
+		datacenters = cfg.Global.Datacenter
+	}
+	if vc := cfg.VirtualCenter[server]; vc != nil && vc.Datacenters != "" {
+		datacenters = vc.Datacenters
+	}
+	for _, d := range strings.Split(datacenters, ",") {
+		if strings.TrimSpace(d) == dc {
+			return
+		}
+	}
+	result.Fail(key("Workspace", "datacenter"), fmt.Sprintf("%q is not in datacenters of %s", dc, vcSection(server)),
+		fmt.Sprintf("Add %q to datacenters of %s", dc, vcSection(server)))
+}
+
+func lintCredentials(cfg *vmware.Config, opts Options, result *check.Result) {
+	if opts.InConfigMap {
+		if cfg.Global.User != "" {
+			result.Warn(key("Global", "user"), "vCenter user is stored in plain text in a ConfigMap", "Store the credentials in a Secret referenced by Global secret-name and secret-namespace")
+		}
+		if cfg.Global.Password != "" {
+			result.Fail(key("Global", "password"), "vCenter password is stored in plain text in a ConfigMap", "Store the credentials in a Secret referenced by Global secret-name and secret-namespace")
+		}
+		for _, server := range sortedServers(cfg) {
+			vc := cfg.VirtualCenter[server]
+			if vc != nil && vc.Password != "" {
+				result.Fail(key(vcSection(server), "password"), "vCenter password is stored in plain text in a ConfigMap", "Store the credentials in a Secret referenced by Global secret-name and secret-namespace")
+			}
+		}
+	}
+
+	switch {
+	case cfg.Global.SecretName != "" && cfg.Global.SecretNamespace == "":
+		result.Fail(key("Global", "secret-namespace"), "secret-name is set, but secret-namespace is not", "Set namespace of the Secret with vCenter credentials")
+	case cfg.Global.SecretName == "" && cfg.Global.SecretNamespace != "":
+		result.Fail(key("Global", "secret-name"), "secret-namespace is set, but secret-name is not", "Set name of the Secret with vCenter credentials")
+	}
+	for _, server := range sortedServers(cfg) {
+		extra := cfg.VirtualCenterExtra[server]
+		if extra == nil {
+			continue
+		}
+		switch {
+		case extra.SecretName != "" && extra.SecretNamespace == "" && cfg.Global.SecretNamespace == "":
+			result.Fail(key(vcSection(server), "secret-namespace"), "secret-name is set, but secret-namespace is not set here nor in Global", "Set namespace of the Secret with vCenter credentials")
+		case extra.SecretName == "" && extra.SecretNamespace != "":
+			result.Fail(key(vcSection(server), "secret-name"), "secret-namespace is set, but secret-name is not", "Set name of the Secret with vCenter credentials")
+		}
+	}
+
+	for _, vc := range vmware.GetVCenters(cfg) {
+		if vc.SecretName != "" || (vc.User != "" && vc.Password != "") {
+			continue
+		}
+		object := key("Global", "secret-name")
+		if len(cfg.VirtualCenter) > 0 {
+			object = key(vcSection(vc.Server), "secret-name")
+		}
+		result.Fail(object, fmt.Sprintf("no Secret with credentials of vCenter %s and no user and password are set", vc.Server), "Set secret-name and secret-namespace of the Secret with vCenter credentials")
+	}
+}
+
+func lintTLS(cfg *vmware.Config, result *check.Result) {
+	if cfg.Global.InsecureFlag {
+		if cfg.Global.CAFile != "" {
+			result.Warn(key("Global", "insecure-flag"), "insecure-flag is set together with ca-file, the CA file is ignored", "Remove insecure-flag to verify the vCenter certificate")
+		}
+		if cfg.Global.Thumbprint != "" {
+			result.Warn(key("Global", "insecure-flag"), "insecure-flag is set together with thumbprint, the thumbprint is ignored", "Remove insecure-flag to verify the vCenter certificate")
+		}
+	}
+	for _, server := range sortedServers(cfg) {
+		section := vcSection(server)
+		vc := cfg.VirtualCenter[server]
+		extra := cfg.VirtualCenterExtra[server]
+		flagSection := "Global"
+		switch {
+		case cfg.Global.InsecureFlag:
+		case extra != nil && extra.InsecureFlag:
+			flagSection = section
+		default:
+			continue
+		}
+		fix := fmt.Sprintf("Remove insecure-flag from %s to verify the vCenter certificate", flagSection)
+		if vc != nil && vc.Thumbprint != "" {
+			result.Warn(key(section, "thumbprint"), fmt.Sprintf("%s insecure-flag is set, the thumbprint is ignored", flagSection), fix)
+		}
+		if extra != nil && extra.CAFile != "" {
+			result.Warn(key(section, "ca-file"), fmt.Sprintf("%s insecure-flag is set, the CA file is ignored", flagSection), fix)
+		}
+		if flagSection == section {
+			// Global ca-file and thumbprint are ignored only for this vCenter.
+			if cfg.Global.CAFile != "" && extra.CAFile == "" {
+				result.Warn(key(section, "insecure-flag"), "insecure-flag is set, Global ca-file is ignored for this vCenter", fix)
+			}
+			if cfg.Global.Thumbprint != "" && (vc == nil || vc.Thumbprint == "") {
+				result.Warn(key(section, "insecure-flag"), "insecure-flag is set, Global thumbprint is ignored for this vCenter", fix)
+			}
+		}
+	}
+}
+
+func lintServers(cfg *vmware.Config, result *check.Result) {
+	if cfg.Global.VCenterIP != "" {
+		lintServer(key("Global", "server"), cfg.Global.VCenterIP, result)
+	}
+	if cfg.Global.VCenterPort != "" {
+		lintPort(key("Global", "port"), cfg.Global.VCenterPort, result)
+	}
+	for _, server := range sortedServers(cfg) {
+		section := vcSection(server)
+		lintServer(check.Object{Kind: KindConfigKey, Name: section}, server, result)
+		if vc := cfg.VirtualCenter[server]; vc != nil && vc.VCenterPort != "" {
+			lintPort(key(section, "port"), vc.VCenterPort, result)
+		}
+	}
+}
+
+// lintServer checks that the server is a plain host name or IP address.
+func lintServer(object check.Object, server string, result *check.Result) {
+	fix := "Use only host name or IP address of the vCenter, without scheme, port or path"
+	if strings.Contains(server, "://") {
+		result.Fail(object, fmt.Sprintf("server %q contains URL scheme", server), fix)
+		return
+	}
+	u, err := url.Parse("https://" + server)
+	if err != nil || u.Host != server || u.User != nil {
+		result.Fail(object, fmt.Sprintf("server %q is not a valid host name", server), fix)
+		return
+	}
+	if u.Port() != "" {
+		result.Fail(object, fmt.Sprintf("server %q contains port", server), "Use port key for the vCenter port")
+		return
+	}
+	if net.ParseIP(strings.Trim(server, "[]")) == nil && strings.ContainsAny(server, " _[]") {
+		result.Fail(object, fmt.Sprintf("server %q is not a valid host name", server), fix)
+	}
+}
+
+func lintPort(object check.Object, port string, result *check.Result) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		result.Fail(object, fmt.Sprintf("port %q is not a number between 1 and 65535", port), "Set a valid vCenter port, usually 443")
+	}
+}
@@ -0,0 +1,221 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/vmware"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		opts   Options
+		// expected are "<severity> <object name>" of all findings.
+		expected []string
+	}{
+		{
+			name: "valid in-tree config",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+
+[Workspace]
+server = "vc1.example.com"
+datacenter = "dc1"
+default-datastore = "ds1"
+folder = "/dc1/vm/cluster"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+		},
+		{
+			name: "in-tree config with deprecated keys",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+datacenter = "dc1"
+datastore = "ds1"
+
+[Workspace]
+server = "vc1.example.com"
+datacenter = "dc1"
+
+[VirtualCenter "vc1.example.com"]
+`,
+			expected: []string{
+				"warn Global datacenter",
+				"warn Global datastore",
+			},
+		},
+		{
+			name: "in-tree config with Workspace not matching VirtualCenter",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+
+[Workspace]
+server = "vc2.example.com"
+datacenter = "dc1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+			expected: []string{
+				"fail Workspace server",
+			},
+		},
+		{
+			name: "in-tree config with Workspace datacenter not in VirtualCenter",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+
+[Workspace]
+server = "vc1.example.com"
+datacenter = "dc2"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+			expected: []string{
+				"fail Workspace datacenter",
+			},
+		},
+		{
+			name: "in-tree config with password in ConfigMap",
+			config: `
+[Global]
+user = "admin"
+password = "secret"
+
+[Workspace]
+server = "vc1.example.com"
+datacenter = "dc1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+			opts: Options{InConfigMap: true},
+			expected: []string{
+				"warn Global user",
+				"fail Global password",
+			},
+		},
+		{
+			name: "CPI INI config with only keys known to the in-tree parser",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+insecure-flag = "1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+			opts: Options{InConfigMap: true},
+		},
+		{
+			name: "CPI INI config with insecure-flag and ca-file",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+ca-file = "/etc/ssl/global.pem"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+insecure-flag = true
+ca-file = "/etc/ssl/vc1.pem"
+`,
+			expected: []string{
+				`warn VirtualCenter "vc1.example.com" ca-file`,
+			},
+		},
+		{
+			name: "CPI INI config with secret-namespace without secret-name",
+			config: `
+[Global]
+user = "admin"
+password = "secret"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+secret-namespace = "kube-system"
+`,
+			expected: []string{
+				`fail VirtualCenter "vc1.example.com" secret-name`,
+			},
+		},
+		{
+			name: "CPI INI config with URL and invalid port",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+
+[VirtualCenter "https://vc1.example.com"]
+datacenters = "dc1"
+port = "100000"
+`,
+			expected: []string{
+				`fail VirtualCenter "https://vc1.example.com"`,
+				`fail VirtualCenter "https://vc1.example.com" port`,
+			},
+		},
+		{
+			name: "valid CSI config",
+			config: `
+[Global]
+cluster-id = "cluster1"
+
+[VirtualCenter "vc1.example.com"]
+user = "admin"
+password = "secret"
+datacenters = "dc1,dc2"
+`,
+		},
+		{
+			name: "CSI config without credentials",
+			config: `
+[Global]
+cluster-id = "cluster1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+			expected: []string{
+				`fail VirtualCenter "vc1.example.com" secret-name`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := vmware.ParseConfig(test.config)
+			if err != nil {
+				t.Fatalf("failed to parse config: %s", err)
+			}
+			result := Lint(cfg, test.opts)
+			var findings []string
+			for _, f := range result.Findings {
+				findings = append(findings, string(f.Severity)+" "+f.Object.Name)
+				if f.Object.Kind != KindConfigKey {
+					t.Errorf("expected finding kind %s, got %s", KindConfigKey, f.Object.Kind)
+				}
+			}
+			if !reflect.DeepEqual(findings, test.expected) {
+				for _, f := range result.Findings {
+					t.Logf("got %+v", f)
+				}
+				t.Errorf("expected findings %q, got %q", test.expected, findings)
+			}
+		})
+	}
+}
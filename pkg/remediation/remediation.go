@@ -0,0 +1,231 @@
+package remediation
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/check"
+	"github.com/jsafrane/vmware-check/pkg/report"
+)
+
+const (
+	FormatGovc     = "govc"
+	FormatPowerCLI = "powercli"
+
+	rolePrefix = "openshift-"
+)
+
+// propagate says if permission on given kind of entity should be propagated
+// to its children, as documented in OpenShift installation documentation.
+var propagate = map[check.ObjectKind]bool{
+	check.KindVCenter:      false,
+	check.KindDatacenter:   false,
+	check.KindCluster:      true,
+	check.KindResourcePool: true,
+	check.KindDatastore:    false,
+	check.KindNetwork:      false,
+	check.KindFolder:       true,
+}
+
+// Options of the generated script.
+type Options struct {
+	// Principal is the vCenter user or group that gets the permissions.
+	Principal string
+	// Datacenter is the default datacenter for relative entity paths.
+	Datacenter string
+}
+
+// role is a vCenter role and all entities where it should be assigned.
+type role struct {
+	name       string
+	kind       check.ObjectKind
+	privileges []string
+	entities   []string
+}
+
+// ValidateFormat returns error when the script format is not supported.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatGovc, FormatPowerCLI:
+		return nil
+	default:
+		return fmt.Errorf("unsupported remediation script format %q, use %q or %q", format, FormatGovc, FormatPowerCLI)
+	}
+}
+
+// Write writes a script that grants all missing privileges found in the report.
+// It creates one least-privilege role per kind of entity with all privileges
+// OpenShift needs on that kind of entity and assigns the role to each
+// entity with missing privileges.
+// The script connects to a single vCenter, missing privileges in the other
+// vCenters are only listed in a comment.
+func Write(w io.Writer, format string, rep *report.Report, opts Options) error {
+	roles, otherVCenters := getRoles(rep)
+	switch format {
+	case FormatGovc:
+		return writeGovc(w, roles, otherVCenters, opts)
+	case FormatPowerCLI:
+		return writePowerCLI(w, roles, otherVCenters, opts)
+	default:
+		return ValidateFormat(format)
+	}
+}
+
+// getRoles collects roles from all failed findings with missing privileges
+// in the default vCenter. It returns also all other vCenters with missing
+// privileges.
+func getRoles(rep *report.Report) ([]*role, []string) {
+	roles := map[check.ObjectKind]*role{}
+	var otherVCenters []string
+	for _, c := range rep.Checks {
+		for _, f := range c.Findings {
+			if f.Severity != check.StatusFail || len(f.Privileges) == 0 || f.Object.Kind == "" {
+				continue
+			}
+			if f.Object.VCenter != "" {
+				otherVCenters = mergeStrings(otherVCenters, []string{f.Object.VCenter})
+				continue
+			}
+			r, found := roles[f.Object.Kind]
+			if !found {
+				r = &role{
+					name: rolePrefix + strings.ToLower(string(f.Object.Kind)),
+					kind: f.Object.Kind,
+				}
+				roles[f.Object.Kind] = r
+			}
+			r.privileges = mergeStrings(r.privileges, check.RequiredPrivileges(f.Object.Kind), f.Privileges)
+			r.entities = mergeStrings(r.entities, []string{f.Object.Name})
+		}
+	}
+
+	var list []*role
+	for _, r := range roles {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list, otherVCenters
+}
+
+func writeGovc(w io.Writer, roles []*role, otherVCenters []string, opts Options) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Generated by vmware-check. Review the script before running it!\n")
+	fmt.Fprintf(&b, "# Set GOVC_URL, GOVC_USERNAME and GOVC_PASSWORD of a vCenter administrator first.\n")
+	fmt.Fprintf(&b, "set -e\n\n")
+	fmt.Fprintf(&b, "PRINCIPAL=%s\n", shellQuote(opts.Principal))
+	if opts.Datacenter != "" {
+		fmt.Fprintf(&b, "export GOVC_DATACENTER=%s\n", shellQuote(opts.Datacenter))
+	}
+	writeOtherVCenters(&b, otherVCenters)
+	if len(roles) == 0 {
+		fmt.Fprintf(&b, "\n# No missing privileges found.\n")
+	}
+
+	for _, r := range roles {
+		fmt.Fprintf(&b, "\n# Role for %s entities\n", r.kind)
+		privileges := strings.Join(r.privileges, " ")
+		fmt.Fprintf(&b, "if govc role.ls %s >/dev/null 2>&1; then\n", shellQuote(r.name))
+		fmt.Fprintf(&b, "  govc role.update -a %s %s\n", shellQuote(r.name), privileges)
+		fmt.Fprintf(&b, "else\n")
+		fmt.Fprintf(&b, "  govc role.create %s %s\n", shellQuote(r.name), privileges)
+		fmt.Fprintf(&b, "fi\n")
+		for _, e := range r.entities {
+			fmt.Fprintf(&b, "govc permissions.set -principal \"$PRINCIPAL\" -role %s -propagate=%t %s\n", shellQuote(r.name), propagate[r.kind], shellQuote(e))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writePowerCLI(w io.Writer, roles []*role, otherVCenters []string, opts Options) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by vmware-check. Review the script before running it!\n")
+	fmt.Fprintf(&b, "# Connect to the vCenter as an administrator first: Connect-VIServer <server>\n")
+	fmt.Fprintf(&b, "$ErrorActionPreference = 'Stop'\n\n")
+	fmt.Fprintf(&b, "$principal = %s\n", psQuote(opts.Principal))
+	writeOtherVCenters(&b, otherVCenters)
+	if len(roles) == 0 {
+		fmt.Fprintf(&b, "\n# No missing privileges found.\n")
+	}
+
+	for _, r := range roles {
+		fmt.Fprintf(&b, "\n# Role for %s entities\n", r.kind)
+		var quoted []string
+		for _, p := range r.privileges {
+			quoted = append(quoted, psQuote(p))
+		}
+		fmt.Fprintf(&b, "$privileges = Get-VIPrivilege -Id @(%s)\n", strings.Join(quoted, ", "))
+		fmt.Fprintf(&b, "$role = Get-VIRole -Name %s -ErrorAction SilentlyContinue\n", psQuote(r.name))
+		fmt.Fprintf(&b, "if ($role) {\n")
+		fmt.Fprintf(&b, "  $role = Set-VIRole -Role $role -AddPrivilege $privileges\n")
+		fmt.Fprintf(&b, "} else {\n")
+		fmt.Fprintf(&b, "  $role = New-VIRole -Name %s -Privilege $privileges\n", psQuote(r.name))
+		fmt.Fprintf(&b, "}\n")
+		for _, e := range r.entities {
+			fmt.Fprintf(&b, "New-VIPermission -Entity (%s) -Principal $principal -Role $role -Propagate:$%t\n", powerCLIEntity(r.kind, e), propagate[r.kind])
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeOtherVCenters writes a comment with vCenters whose missing privileges
+// are not granted by the script. Both script formats use "#" for comments.
+func writeOtherVCenters(b *strings.Builder, otherVCenters []string) {
+	for _, server := range otherVCenters {
+		fmt.Fprintf(b, "# Missing privileges in vCenter %s are not granted by this script, see the report.\n", server)
+	}
+}
+
+// powerCLIEntity returns PowerCLI expression that gets the entity.
+func powerCLIEntity(kind check.ObjectKind, entityPath string) string {
+	name := psQuote(path.Base(entityPath))
+	switch kind {
+	case check.KindVCenter:
+		return "Get-Folder -NoRecursion"
+	case check.KindDatacenter:
+		return "Get-Datacenter -Name " + name
+	case check.KindCluster:
+		return "Get-Cluster -Name " + name
+	case check.KindResourcePool:
+		return "Get-ResourcePool -Name " + name
+	case check.KindDatastore:
+		return "Get-Datastore -Name " + name
+	case check.KindNetwork:
+		return "Get-VirtualNetwork -Name " + name
+	case check.KindFolder:
+		return "Get-Folder -Name " + name
+	default:
+		return "Get-Inventory -Name " + name
+	}
+}
+
+// mergeStrings returns sorted union of all lists.
+func mergeStrings(lists ...[]string) []string {
+	set := map[string]bool{}
+	for _, l := range lists {
+		for _, s := range l {
+			set[s] = true
+		}
+	}
+	var merged []string
+	for s := range set {
+		merged = append(merged, s)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+func psQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,95 @@
+package remediation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jsafrane/vmware-check/pkg/check"
+	"github.com/jsafrane/vmware-check/pkg/report"
+)
+
+func TestWriteGovcEntities(t *testing.T) {
+	rep := &report.Report{
+		Checks: []report.CheckReport{
+			{
+				Name:   "privileges",
+				Status: check.StatusFail,
+				Findings: []check.Finding{
+					{
+						Severity:   check.StatusFail,
+						Object:     check.Object{Kind: check.KindDatastore, Name: "/DC0/datastore/ds1"},
+						Message:    "missing privileges",
+						Privileges: []string{"Datastore.AllocateSpace", "Datastore.Browse"},
+					},
+					{
+						Severity:   check.StatusFail,
+						Object:     check.Object{Kind: check.KindFolder, Name: "/DC0/vm/cluster"},
+						Message:    "missing privileges",
+						Privileges: []string{"VirtualMachine.Config.AddExistingDisk"},
+					},
+					{
+						Severity:   check.StatusFail,
+						Object:     check.Object{Kind: check.KindCluster, Name: "/DC0/host/cluster"},
+						Message:    "missing privileges",
+						Privileges: []string{"Resource.AssignVMToPool"},
+					},
+					{
+						// Privileges in other vCenters are only listed in a comment.
+						Severity:   check.StatusFail,
+						Object:     check.Object{Kind: check.KindDatacenter, Name: "/DC1", VCenter: "vc2.example.com"},
+						Message:    "missing privileges",
+						Privileges: []string{"System.Read"},
+					},
+					{
+						// Warnings are not remediated.
+						Severity:   check.StatusWarn,
+						Object:     check.Object{Kind: check.KindNetwork, Name: "/DC0/network/VM Network"},
+						Message:    "privilege is not propagated",
+						Privileges: []string{"Network.Assign"},
+					},
+				},
+			},
+			{
+				Name:   "folder",
+				Status: check.StatusFail,
+				Findings: []check.Finding{
+					{
+						Severity:   check.StatusFail,
+						Object:     check.Object{Kind: check.KindDatastore, Name: "/DC0/datastore/ds1"},
+						Message:    "failed to browse Datastore ds1: permission denied",
+						Privileges: []string{"Datastore.Browse"},
+					},
+				},
+			},
+		},
+	}
+
+	var b strings.Builder
+	if err := Write(&b, FormatGovc, rep, Options{Principal: "user@vsphere.local", Datacenter: "DC0"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	script := b.String()
+
+	// Each entity gets the permission once, with its absolute inventory path.
+	expected := []string{
+		`govc permissions.set -principal "$PRINCIPAL" -role 'openshift-cluster' -propagate=true '/DC0/host/cluster'`,
+		`govc permissions.set -principal "$PRINCIPAL" -role 'openshift-datastore' -propagate=false '/DC0/datastore/ds1'`,
+		`govc permissions.set -principal "$PRINCIPAL" -role 'openshift-folder' -propagate=true '/DC0/vm/cluster'`,
+	}
+	var permissions []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(line, "govc permissions.set ") {
+			permissions = append(permissions, line)
+		}
+	}
+	if !reflect.DeepEqual(permissions, expected) {
+		t.Errorf("expected permissions:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(permissions, "\n"))
+	}
+	if !strings.Contains(script, "# Missing privileges in vCenter vc2.example.com are not granted by this script") {
+		t.Errorf("expected comment about vCenter vc2.example.com:\n%s", script)
+	}
+	if !strings.Contains(script, "Datastore.Browse") {
+		t.Errorf("expected Datastore.Browse privilege in the script:\n%s", script)
+	}
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jsafrane/vmware-check/pkg/check"
+)
+
+// JUnit XML schema, as understood by most CI systems.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML. Each check is a test suite and
+// each object with findings is a test case. A check without findings
+// is reported as a single passed test case.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{}
+	for i := range r.Checks {
+		suites.Suites = append(suites.Suites, checkToJUnit(&r.Checks[i]))
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func checkToJUnit(c *CheckReport) junitTestSuite {
+	suite := junitTestSuite{
+		Name:      c.Name,
+		Time:      c.Duration,
+		Timestamp: c.StartTime.Format("2006-01-02T15:04:05"),
+	}
+
+	switch {
+	case c.Status == check.StatusSkip:
+		suite.TestCases = []junitTestCase{{
+			Name:      c.Name,
+			Classname: c.Name,
+			Skipped:   &junitMessage{Message: c.Message},
+		}}
+	case len(c.Findings) == 0:
+		suite.TestCases = []junitTestCase{{
+			Name:      c.Name,
+			Classname: c.Name,
+			Time:      c.Duration,
+			SystemOut: c.Message,
+		}}
+	default:
+		suite.TestCases = findingsToJUnit(c.Name, c.Findings)
+	}
+
+	suite.Tests = len(suite.TestCases)
+	for _, tc := range suite.TestCases {
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+		if tc.Error != nil {
+			suite.Errors++
+		}
+		if tc.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	return suite
+}
+
+// findingsToJUnit creates one test case per affected object. Failures
+// (and errors) of the same object are merged into a single failure (error),
+// warnings and informative findings are reported in the test case output.
+func findingsToJUnit(checkName string, findings []check.Finding) []junitTestCase {
+	var testCases []junitTestCase
+	index := map[check.Object]int{}
+	for _, f := range findings {
+		i, found := index[f.Object]
+		if !found {
+			name := checkName
+			if f.Object.Kind != "" {
+				name = fmt.Sprintf("%s %s", f.Object.Kind, f.Object.Name)
+				if f.Object.VCenter != "" {
+					name += " in vCenter " + f.Object.VCenter
+				}
+			}
+			testCases = append(testCases, junitTestCase{
+				Name:      name,
+				Classname: checkName,
+			})
+			i = len(testCases) - 1
+			index[f.Object] = i
+		}
+		tc := &testCases[i]
+
+		text := f.Message
+		if f.Fix != "" {
+			text = fmt.Sprintf("%s\nFix: %s", f.Message, f.Fix)
+		}
+		switch f.Severity {
+		case check.StatusInfo:
+			tc.SystemOut = joinLines(tc.SystemOut, text)
+			continue
+		case check.StatusWarn:
+			tc.SystemOut = joinLines(tc.SystemOut, "Warning: "+text)
+			continue
+		case check.StatusError:
+			tc.Error = addJUnitMessage(tc.Error, f.Message, text)
+			continue
+		}
+		tc.Failure = addJUnitMessage(tc.Failure, f.Message, text)
+	}
+	return testCases
+}
+
+// addJUnitMessage appends a message to an existing failure or error, or
+// returns a new one when msg is nil.
+func addJUnitMessage(msg *junitMessage, message, text string) *junitMessage {
+	if msg == nil {
+		return &junitMessage{Message: message, Content: text}
+	}
+	msg.Message = strings.Join([]string{msg.Message, message}, "; ")
+	msg.Content = joinLines(msg.Content, text)
+	return msg
+}
+
+func joinLines(s, line string) string {
+	if s == "" {
+		return line
+	}
+	return s + "\n" + line
+}
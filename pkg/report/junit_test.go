@@ -0,0 +1,128 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jsafrane/vmware-check/pkg/check"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	node := check.Object{Kind: check.KindNode, Name: "node-0"}
+	tests := []struct {
+		name          string
+		result        *check.Result
+		expectedSuite junitTestSuite
+	}{
+		{
+			name: "passing check",
+			result: &check.Result{
+				Status:  check.StatusPass,
+				Message: "3 nodes checked",
+			},
+			expectedSuite: junitTestSuite{
+				Name:  "passing check",
+				Tests: 1,
+				TestCases: []junitTestCase{
+					{Name: "passing check", Classname: "passing check", SystemOut: "3 nodes checked"},
+				},
+			},
+		},
+		{
+			name:   "skipped check",
+			result: check.SkippedResult("Kubernetes API is not available"),
+			expectedSuite: junitTestSuite{
+				Name:    "skipped check",
+				Tests:   1,
+				Skipped: 1,
+				TestCases: []junitTestCase{
+					{
+						Name:      "skipped check",
+						Classname: "skipped check",
+						Skipped:   &junitMessage{Message: "Kubernetes API is not available"},
+					},
+				},
+			},
+		},
+		{
+			name: "two failures on one object",
+			result: &check.Result{
+				Status: check.StatusFail,
+				Findings: []check.Finding{
+					{Severity: check.StatusFail, Object: node, Message: "providerID is empty", Fix: "Set providerID"},
+					{Severity: check.StatusWarn, Object: node, Message: "VMware Tools are old"},
+					{Severity: check.StatusFail, Object: node, Message: "disk.enableUUID is not enabled"},
+				},
+			},
+			expectedSuite: junitTestSuite{
+				Name:     "two failures on one object",
+				Tests:    1,
+				Failures: 1,
+				TestCases: []junitTestCase{
+					{
+						Name:      "Node node-0",
+						Classname: "two failures on one object",
+						Failure: &junitMessage{
+							Message: "providerID is empty; disk.enableUUID is not enabled",
+							Content: "providerID is empty\nFix: Set providerID\ndisk.enableUUID is not enabled",
+						},
+						SystemOut: "Warning: VMware Tools are old",
+					},
+				},
+			},
+		},
+		{
+			name: "error finding",
+			result: &check.Result{
+				Status: check.StatusError,
+				Findings: []check.Finding{
+					{Severity: check.StatusError, Message: "check failed: connection refused"},
+				},
+			},
+			expectedSuite: junitTestSuite{
+				Name:   "error finding",
+				Tests:  1,
+				Errors: 1,
+				TestCases: []junitTestCase{
+					{
+						Name:      "error finding",
+						Classname: "error finding",
+						Error: &junitMessage{
+							Message: "check failed: connection refused",
+							Content: "check failed: connection refused",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rep := NewReport(ClusterInfo{})
+			start := time.Date(2021, 10, 9, 12, 44, 46, 0, time.UTC)
+			rep.AddResult(check.Check{Name: test.name}, test.result, start, 0)
+
+			buf := &bytes.Buffer{}
+			if err := rep.WriteJUnit(buf); err != nil {
+				t.Fatalf("failed to write JUnit: %s", err)
+			}
+			var suites junitTestSuites
+			if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+				t.Fatalf("failed to parse JUnit: %s\n%s", err, buf.String())
+			}
+			if len(suites.Suites) != 1 {
+				t.Fatalf("expected 1 test suite, got %d", len(suites.Suites))
+			}
+			suite := suites.Suites[0]
+			expected := test.expectedSuite
+			expected.Timestamp = "2021-10-09T12:44:46"
+			if !reflect.DeepEqual(suite, expected) {
+				t.Errorf("expected:\n%+v\ngot:\n%+v\n%s", expected, suite, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jsafrane/vmware-check/pkg/check"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is version of the report schema. It must be bumped
+	// on any incompatible change of the report structure.
+	APIVersion = "vmware-check/v1"
+
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Report is a machine readable report of all checks.
+type Report struct {
+	APIVersion string `json:"apiVersion"`
+	// Cluster and vCenter the checks were run against.
+	Cluster ClusterInfo `json:"cluster"`
+	// StartTime is time when the first check started.
+	StartTime time.Time `json:"startTime"`
+	// Checks are results of all checks, in the order they were run.
+	Checks []CheckReport `json:"checks"`
+}
+
+// ClusterInfo identifies the cluster and vCenter.
+type ClusterInfo struct {
+	// InfrastructureName is Infrastructure.Status.InfrastructureName of the cluster.
+	InfrastructureName string `json:"infrastructureName,omitempty"`
+	// VCenter is address of the default vCenter from the Workspace section.
+	VCenter string `json:"vCenter,omitempty"`
+	// VCenters are addresses of all configured vCenters.
+	VCenters []string `json:"vCenters,omitempty"`
+}
+
+// CheckReport is result of a single check.
+type CheckReport struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Status      check.Status    `json:"status"`
+	Message     string          `json:"message,omitempty"`
+	Findings    []check.Finding `json:"findings,omitempty"`
+	StartTime   time.Time       `json:"startTime"`
+	// Duration of the check in seconds.
+	Duration float64 `json:"durationSeconds"`
+}
+
+// NewReport returns a new empty report.
+func NewReport(cluster ClusterInfo) *Report {
+	return &Report{
+		APIVersion: APIVersion,
+		Cluster:    cluster,
+		StartTime:  time.Now(),
+	}
+}
+
+// AddResult adds result of a single check to the report.
+func (r *Report) AddResult(c check.Check, result *check.Result, start time.Time, duration time.Duration) {
+	r.Checks = append(r.Checks, CheckReport{
+		Name:        c.Name,
+		Description: c.Description,
+		Status:      result.Status,
+		Message:     result.Message,
+		Findings:    result.Findings,
+		StartTime:   start,
+		Duration:    duration.Seconds(),
+	})
+}
+
+// ValidateFormat returns error when the report format is not supported.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, use %q or %q", format, FormatJSON, FormatYAML)
+	}
+}
+
+// Write writes the report in given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	return WriteObject(w, format, r)
+}
+
+// WriteObject writes any object in given format.
+func WriteObject(w io.Writer, format string, obj interface{}) error {
+	var data []byte
+	var err error
+	switch format {
+	case FormatJSON:
+		data, err = json.MarshalIndent(obj, "", "  ")
+		data = append(data, '\n')
+	case FormatYAML:
+		data, err = yaml.Marshal(obj)
+	default:
+		err = ValidateFormat(format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Status returns the most severe status of all checks. Skipped checks are ignored.
+func (r *Report) Status() check.Status {
+	status := check.StatusPass
+	for _, c := range r.Checks {
+		if c.Status.WorseThan(status) {
+			status = c.Status
+		}
+	}
+	return status
+}
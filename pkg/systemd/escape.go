@@ -0,0 +1,73 @@
+package systemd
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// UnitNameMax is the maximum length of a systemd unit name, including
+	// the unit type suffix (UNIT_NAME_MAX - 1 in systemd sources).
+	UnitNameMax = 255
+
+	// validChars are characters that are not escaped in unit names.
+	validChars = "0123456789" +
+		"abcdefghijklmnopqrstuvwxyz" +
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+		":_."
+)
+
+// Escape escapes a string for use in a systemd unit name, the same way
+// as "systemd-escape <s>" does:
+//   - "/" is replaced by "-".
+//   - A leading "." and all bytes except ASCII alphanumerics, ":", "_" and "."
+//     are replaced by C-style "\xNN" escape.
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c == '.' && i == 0:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		case strings.IndexByte(validChars, c) < 0:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// EscapePath escapes a file system path for use in a systemd unit name,
+// the same way as "systemd-escape --path <path>" does. The path is
+// simplified first: duplicate slashes and "." components are removed,
+// as well as leading and trailing slashes. The root directory is escaped
+// as "-". Paths with ".." components are rejected.
+func EscapePath(path string) (string, error) {
+	var components []string
+	for _, c := range strings.Split(path, "/") {
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("path %q is not normalized", path)
+		}
+		components = append(components, c)
+	}
+	if len(components) == 0 {
+		return "-", nil
+	}
+	return Escape(strings.Join(components, "/")), nil
+}
+
+// MountUnitName returns name of the systemd mount unit for given mount point,
+// the same way as "systemd-escape --path --suffix=mount <path>" does.
+func MountUnitName(path string) (string, error) {
+	escaped, err := EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	return escaped + ".mount", nil
+}
@@ -0,0 +1,79 @@
+package systemd
+
+import (
+	"testing"
+)
+
+// Expected values are output of "systemd-escape --path --suffix=mount <path>".
+func TestMountUnitName(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "root",
+			path:     "/",
+			expected: "-.mount",
+		},
+		{
+			name:     "simple path",
+			path:     "/var/lib/kubelet",
+			expected: "var-lib-kubelet.mount",
+		},
+		{
+			name:     "duplicate slashes and dot components",
+			path:     "//var//lib/./kubelet/",
+			expected: "var-lib-kubelet.mount",
+		},
+		{
+			name:     "leading dot",
+			path:     "/.hidden/x",
+			expected: `\x2ehidden-x.mount`,
+		},
+		{
+			name:     "dot not at the beginning",
+			path:     "/a/.b",
+			expected: "a-.b.mount",
+		},
+		{
+			name:     "dash",
+			path:     "/a-b/c",
+			expected: `a\x2db-c.mount`,
+		},
+		{
+			name:     "space and brackets",
+			path:     "/mnt/[ds 1] vol.vmdk",
+			expected: `mnt-\x5bds\x201\x5d\x20vol.vmdk.mount`,
+		},
+		{
+			name:     "multi-byte UTF-8",
+			path:     "/mnt/žluťoučký",
+			expected: `mnt-\xc5\xbelu\xc5\xa5ou\xc4\x8dk\xc3\xbd.mount`,
+		},
+		{
+			name:        "dot dot component",
+			path:        "/a/../b",
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unit, err := MountUnitName(test.path)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error, got unit %q", unit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if unit != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, unit)
+			}
+		})
+	}
+}
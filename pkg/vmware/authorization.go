@@ -0,0 +1,387 @@
+package vmware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+)
+
+// MissingPrivileges returns privileges from privIDs that the current
+// vCenter session does not hold on given entity.
+func MissingPrivileges(ctx context.Context, vc *VCenter, entity types.ManagedObjectReference, privIDs []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	session, err := vc.Client.SessionManager.UserSession(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current session: %s", err)
+	}
+	if session == nil {
+		return nil, fmt.Errorf("failed to get current session: not logged in")
+	}
+
+	authz := object.NewAuthorizationManager(vc.Client.Client)
+	req := types.HasPrivilegeOnEntities{
+		This:      authz.Reference(),
+		Entity:    []types.ManagedObjectReference{entity},
+		SessionId: session.Key,
+		PrivId:    privIDs,
+	}
+	res, err := methods.HasPrivilegeOnEntities(ctx, vc.Client.Client, &req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check privileges on %s: %s", entity.Value, err)
+	}
+
+	granted := map[string]bool{}
+	for _, ep := range res.Returnval {
+		for _, p := range ep.PrivAvailability {
+			if p.IsGranted {
+				granted[p.PrivId] = true
+			}
+		}
+	}
+	var missing []string
+	for _, id := range privIDs {
+		if !granted[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// UserGroups returns groups the vCenter user belongs to, as reported by
+// vCenter UserDirectory. Only direct membership is resolved. The groups are
+// resolved on the first call and cached.
+func (vc *VCenter) UserGroups(ctx context.Context) ([]string, error) {
+	vc.groupsOnce.Do(func() {
+		vc.groups, vc.groupsErr = getUserGroups(ctx, vc)
+		if vc.groupsErr != nil {
+			klog.V(2).Infof("Failed to resolve groups of %s in %s: %s", vc.Username, vc.Config.Server, vc.groupsErr)
+		}
+	})
+	return vc.groups, vc.groupsErr
+}
+
+func getUserGroups(ctx context.Context, vc *VCenter) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	dir := vc.Client.ServiceContent.UserDirectory
+	if dir == nil {
+		return nil, fmt.Errorf("vCenter has no user directory")
+	}
+	name, domain := splitPrincipal(vc.Username)
+	req := types.RetrieveUserGroups{
+		This:   *dir,
+		Domain: domain,
+		// Empty search string matches all groups, BelongsToUser filters them.
+		BelongsToUser: name,
+		FindGroups:    true,
+	}
+	res, err := methods.RetrieveUserGroups(ctx, vc.Client.Client, &req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve groups of %s: %s", vc.Username, err)
+	}
+	var groups []string
+	for _, r := range res.Returnval {
+		result := r.GetUserSearchResult()
+		if !result.Group {
+			continue
+		}
+		group := result.Principal
+		if domain != "" && !strings.ContainsAny(group, "\\@") {
+			group = group + "@" + domain
+		}
+		groups = append(groups, group)
+	}
+	klog.V(4).Infof("User %s in %s belongs to groups %v", vc.Username, vc.Config.Server, groups)
+	return groups, nil
+}
+
+// splitPrincipal returns user name and domain of "user@domain" or "DOMAIN\user".
+func splitPrincipal(p string) (string, string) {
+	if i := strings.Index(p, "\\"); i >= 0 {
+		return p[i+1:], p[:i]
+	}
+	if i := strings.LastIndex(p, "@"); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+// principalMembership returns whether a permission of the principal applies
+// to the vCenter user. Permissions of groups are unverified when groups of
+// the user could not be resolved.
+func principalMembership(vc *VCenter, principal string, group bool, groups []string, groupsErr error) (applies, unverified bool) {
+	if !group {
+		return SamePrincipal(principal, vc.Username), false
+	}
+	if groupsErr != nil {
+		return true, true
+	}
+	for _, g := range groups {
+		if SamePrincipal(principal, g) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// PermissionSource is a permission of a user or group, defined on an entity
+// or on one of its ancestors.
+type PermissionSource struct {
+	// EntityPath is inventory path of the entity where the permission is defined.
+	EntityPath string
+	// Inherited is true when the permission is defined on an ancestor of the entity.
+	Inherited bool
+	// Level is distance of the entity where the permission is defined from
+	// the checked entity, 0 for the entity itself, 1 for its parent and so on.
+	Level int
+	// Propagate is true when the permission propagates to children of the entity
+	// where it is defined.
+	Propagate bool
+	// Principal is the user or group that has the permission.
+	Principal string
+	Group     bool
+	// Unverified is true for a group permission when groups of the user
+	// could not be resolved, i.e. the user may not be member of the group.
+	Unverified bool
+	// Role and its privileges.
+	Role       string
+	Privileges []string
+}
+
+// Applies returns true if the permission applies to the entity, i.e. it's
+// defined directly on the entity or it propagates from an ancestor.
+func (p *PermissionSource) Applies() bool {
+	return !p.Inherited || p.Propagate
+}
+
+// GetPermissionSources returns all permissions defined on the entity and all
+// its ancestors up to the root folder that belong to the vCenter user or to
+// its groups. When groups of the user cannot be resolved, permissions of all
+// groups are returned as unverified.
+func GetPermissionSources(ctx context.Context, vc *VCenter, entity types.ManagedObjectReference) ([]PermissionSource, error) {
+	groups, groupsErr := vc.UserGroups(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	authz := object.NewAuthorizationManager(vc.Client.Client)
+	roles, err := authz.RoleList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %s", err)
+	}
+
+	ancestors, err := getAncestors(ctx, vc, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []PermissionSource
+	for i, a := range ancestors {
+		perms, err := authz.RetrieveEntityPermissions(ctx, a.ref, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get permissions of %s: %s", a.path, err)
+		}
+		for _, p := range perms {
+			applies, unverified := principalMembership(vc, p.Principal, p.Group, groups, groupsErr)
+			if !applies {
+				continue
+			}
+			source := PermissionSource{
+				EntityPath: a.path,
+				Inherited:  i > 0,
+				Level:      i,
+				Propagate:  p.Propagate,
+				Principal:  p.Principal,
+				Group:      p.Group,
+				Unverified: unverified,
+				Role:       fmt.Sprintf("%d", p.RoleId),
+			}
+			if role := roles.ById(p.RoleId); role != nil {
+				source.Role = role.Name
+				source.Privileges = role.Privilege
+			}
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// EffectiveSources returns indexes of permissions that define privileges of
+// the user on the entity, following vSphere precedence rules: only applying
+// permissions on the nearest entity that has any count, and a permission of
+// the user overrides permissions of its groups on the same entity.
+// Privileges of all returned permissions are granted, i.e. permissions of
+// groups are unioned. Unverified permissions are ignored.
+func EffectiveSources(sources []PermissionSource) []int {
+	level := -1
+	for i := range sources {
+		s := &sources[i]
+		if s.Applies() && !s.Unverified && (level == -1 || s.Level < level) {
+			level = s.Level
+		}
+	}
+	var user, groups []int
+	for i := range sources {
+		s := &sources[i]
+		if s.Level != level || !s.Applies() || s.Unverified {
+			continue
+		}
+		if s.Group {
+			groups = append(groups, i)
+		} else {
+			user = append(user, i)
+		}
+	}
+	if len(user) > 0 {
+		return user
+	}
+	return groups
+}
+
+// ancestor is an entity in the inventory tree.
+type ancestor struct {
+	ref  types.ManagedObjectReference
+	path string
+}
+
+// getAncestors returns the entity and all its parents up to the root folder.
+func getAncestors(ctx context.Context, vc *VCenter, entity types.ManagedObjectReference) ([]ancestor, error) {
+	var refs []types.ManagedObjectReference
+	var names []string
+	ref := &entity
+	for ref != nil {
+		var e mo.ManagedEntity
+		if err := vc.Client.RetrieveOne(ctx, *ref, []string{"name", "parent"}, &e); err != nil {
+			return nil, fmt.Errorf("failed to get parent of %s: %s", ref.Value, err)
+		}
+		refs = append(refs, *ref)
+		names = append(names, e.Name)
+		ref = e.Parent
+	}
+
+	// Build inventory paths. The root folder itself is "/" and it's not
+	// part of paths of its children.
+	ancestors := make([]ancestor, len(refs))
+	for i := range refs {
+		path := ""
+		for j := len(names) - 2; j >= i; j-- {
+			path += "/" + names[j]
+		}
+		if path == "" {
+			path = "/"
+		}
+		ancestors[i] = ancestor{ref: refs[i], path: path}
+	}
+	return ancestors, nil
+}
+
+// SamePrincipal returns true if both user names identify the same user.
+// vCenter uses "DOMAIN\user" in permissions and "user@domain" when logging in.
+func SamePrincipal(a, b string) bool {
+	return normalizePrincipal(a) == normalizePrincipal(b)
+}
+
+func normalizePrincipal(p string) string {
+	p = strings.ToLower(p)
+	if i := strings.Index(p, "\\"); i >= 0 {
+		return p[i+1:] + "@" + p[:i]
+	}
+	return p
+}
+
+// InventoryPath returns inventory path of the entity.
+func InventoryPath(ctx context.Context, vc *VCenter, entity types.ManagedObjectReference) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	ancestors, err := getAncestors(ctx, vc, entity)
+	if err != nil {
+		return "", err
+	}
+	return ancestors[0].path, nil
+}
+
+// Ancestors returns references to the entity and all its ancestors, starting
+// with the entity itself and ending with the root folder.
+func Ancestors(ctx context.Context, vc *VCenter, entity types.ManagedObjectReference) ([]types.ManagedObjectReference, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	ancestors, err := getAncestors(ctx, vc, entity)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]types.ManagedObjectReference, len(ancestors))
+	for i := range ancestors {
+		refs[i] = ancestors[i].ref
+	}
+	return refs, nil
+}
+
+// UserPermission is a permission of the vCenter user or of one of its groups
+// on an entity.
+type UserPermission struct {
+	Entity    types.ManagedObjectReference
+	Propagate bool
+	// Principal is the user or group that has the permission.
+	Principal string
+	Group     bool
+	// Unverified is true for a group permission when groups of the user
+	// could not be resolved, i.e. the user may not be member of the group.
+	Unverified bool
+	Role       string
+	Privileges []string
+}
+
+// GetUserPermissions returns all permissions of the vCenter user and of groups
+// the user belongs to in the whole vCenter.
+func GetUserPermissions(ctx context.Context, vc *VCenter) ([]UserPermission, error) {
+	groups, groupsErr := vc.UserGroups(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	authz := object.NewAuthorizationManager(vc.Client.Client)
+	roles, err := authz.RoleList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %s", err)
+	}
+	perms, err := authz.RetrieveAllPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %s", err)
+	}
+
+	var userPerms []UserPermission
+	for _, p := range perms {
+		if p.Entity == nil {
+			continue
+		}
+		applies, unverified := principalMembership(vc, p.Principal, p.Group, groups, groupsErr)
+		if !applies {
+			continue
+		}
+		up := UserPermission{
+			Entity:     *p.Entity,
+			Propagate:  p.Propagate,
+			Principal:  p.Principal,
+			Group:      p.Group,
+			Unverified: unverified,
+			Role:       fmt.Sprintf("%d", p.RoleId),
+		}
+		if role := roles.ById(p.RoleId); role != nil {
+			up.Role = role.Name
+			up.Privileges = role.Privilege
+		}
+		userPerms = append(userPerms, up)
+	}
+	return userPerms, nil
+}
@@ -0,0 +1,128 @@
+package vmware
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPrincipalMembership(t *testing.T) {
+	vc := &VCenter{Username: "k8s@vsphere.local"}
+	groups := []string{"k8s-admins@vsphere.local"}
+	tests := []struct {
+		name               string
+		principal          string
+		group              bool
+		groupsErr          error
+		expectedApplies    bool
+		expectedUnverified bool
+	}{
+		{
+			name:            "the user",
+			principal:       `VSPHERE.LOCAL\k8s`,
+			expectedApplies: true,
+		},
+		{
+			name:      "other user",
+			principal: `VSPHERE.LOCAL\admin`,
+		},
+		{
+			name:            "group of the user",
+			principal:       `VSPHERE.LOCAL\k8s-admins`,
+			group:           true,
+			expectedApplies: true,
+		},
+		{
+			name:      "unrelated group",
+			principal: `VSPHERE.LOCAL\Administrators`,
+			group:     true,
+		},
+		{
+			name:               "group with unresolved membership",
+			principal:          `VSPHERE.LOCAL\Administrators`,
+			group:              true,
+			groupsErr:          fmt.Errorf("not supported"),
+			expectedApplies:    true,
+			expectedUnverified: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applies, unverified := principalMembership(vc, test.principal, test.group, groups, test.groupsErr)
+			if applies != test.expectedApplies || unverified != test.expectedUnverified {
+				t.Errorf("expected applies=%t unverified=%t, got %t %t", test.expectedApplies, test.expectedUnverified, applies, unverified)
+			}
+		})
+	}
+}
+
+func TestEffectiveSources(t *testing.T) {
+	user := func(level int, propagate bool, role string) PermissionSource {
+		return PermissionSource{Level: level, Inherited: level > 0, Propagate: propagate, Principal: `VSPHERE.LOCAL\k8s`, Role: role}
+	}
+	group := func(level int, propagate bool, role string) PermissionSource {
+		s := user(level, propagate, role)
+		s.Principal = `VSPHERE.LOCAL\k8s-admins`
+		s.Group = true
+		return s
+	}
+	unverified := func(s PermissionSource) PermissionSource {
+		s.Unverified = true
+		return s
+	}
+	tests := []struct {
+		name     string
+		sources  []PermissionSource
+		expected []int
+	}{
+		{
+			name:    "no permissions",
+			sources: nil,
+		},
+		{
+			name:     "permission on the entity",
+			sources:  []PermissionSource{user(0, false, "vm")},
+			expected: []int{0},
+		},
+		{
+			name:     "No Access on the folder overrides Administrator at the root",
+			sources:  []PermissionSource{user(1, true, "NoAccess"), user(3, true, "Admin")},
+			expected: []int{0},
+		},
+		{
+			name:     "group permission on the folder overrides user permission at the root",
+			sources:  []PermissionSource{group(1, true, "NoAccess"), user(3, true, "Admin")},
+			expected: []int{0},
+		},
+		{
+			name:     "not propagated permission on the folder does not override the root",
+			sources:  []PermissionSource{user(1, false, "NoAccess"), user(3, true, "Admin")},
+			expected: []int{1},
+		},
+		{
+			name:     "user permission overrides group permissions on the same entity",
+			sources:  []PermissionSource{group(1, true, "Admin"), user(1, true, "ReadOnly"), group(1, true, "vm")},
+			expected: []int{1},
+		},
+		{
+			name:     "group permissions on the same entity are unioned",
+			sources:  []PermissionSource{group(1, true, "vm"), group(1, true, "datastore"), user(2, true, "Admin")},
+			expected: []int{0, 1},
+		},
+		{
+			name:     "unverified group permission is ignored",
+			sources:  []PermissionSource{unverified(group(1, true, "NoAccess")), user(3, true, "Admin")},
+			expected: []int{1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			effective := EffectiveSources(test.sources)
+			if !reflect.DeepEqual(effective, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, effective)
+			}
+		})
+	}
+}
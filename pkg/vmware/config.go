@@ -4,12 +4,17 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vim25"
 	"github.com/vmware/govmomi/vim25/soap"
-	"gopkg.in/gcfg.v1"
 	"k8s.io/klog/v2"
 	"k8s.io/legacy-cloud-providers/vsphere"
 )
@@ -18,32 +23,220 @@ var (
 	Timeout = flag.Duration("vmware-timeout", 10*time.Second, "Timeout of all VMware calls")
 )
 
-func ParseConfig(data string) (*vsphere.VSphereConfig, error) {
-	var cfg vsphere.VSphereConfig
-	err := gcfg.ReadStringInto(&cfg, data)
+// Config is parsed vSphere config. It is the in-tree cloud provider config
+// extended with settings that out-of-tree cloud provider and CSI driver
+// configs have per vCenter, while the in-tree config has them only in the
+// Global section.
+type Config struct {
+	vsphere.VSphereConfig
+	// VirtualCenterExtra are per-vCenter settings that are missing in
+	// vsphere.VirtualCenterConfig, keyed by vCenter server.
+	VirtualCenterExtra map[string]*VirtualCenterExtra
+}
+
+// VirtualCenterExtra are TLS settings and the secret reference of a single
+// vCenter. Empty values are inherited from the Global section.
+type VirtualCenterExtra struct {
+	InsecureFlag    bool
+	CAFile          string
+	SecretName      string
+	SecretNamespace string
+}
+
+// VCenterConfig is configuration of a single vCenter, with defaults from
+// the Global section already applied.
+type VCenterConfig struct {
+	// Server is address of the vCenter, as used in the config file.
+	Server string
+	// Port of the vCenter. Empty for the default port.
+	Port string
+	// User and Password from the config file. They're empty when
+	// the credentials are stored in a secret.
+	User     string
+	Password string
+	// Insecure is true when vCenter certificate should not be verified.
+	Insecure bool
+	// CAFile is path to the CA bundle used to verify the vCenter certificate.
+	CAFile string
+	// Thumbprint is the expected SHA-1 thumbprint of the vCenter certificate.
+	Thumbprint string
+	// SecretName and SecretNamespace reference the Secret with credentials
+	// of the vCenter. They're empty when the credentials are in the config.
+	SecretName      string
+	SecretNamespace string
+	// Datacenters are names of all datacenters in the vCenter used by the cluster.
+	Datacenters []string
+}
+
+// VCenter is a connection to a single vCenter.
+type VCenter struct {
+	Config *VCenterConfig
+	Client *govmomi.Client
+	// Username used to log in to the vCenter.
+	Username string
+
+	// groups of the user, resolved by the first UserGroups call.
+	groups     []string
+	groupsErr  error
+	groupsOnce sync.Once
+}
+
+// ParseConfig parses vSphere config in any supported format, see ParseConfigWithFormat.
+func ParseConfig(data string) (*Config, error) {
+	cfg, format, err := ParseConfigWithFormat(data)
 	if err != nil {
 		return nil, err
 	}
-	return &cfg, nil
+	klog.V(2).Infof("Parsed %s config", format)
+	return cfg, nil
+}
+
+// GetVCenters returns configuration of all vCenters in the config, sorted by
+// server name. When the config has no VirtualCenter sections, the (deprecated)
+// Global.VCenterIP or Workspace.VCenterIP is used as the only vCenter.
+func GetVCenters(cfg *Config) []*VCenterConfig {
+	var vcs []*VCenterConfig
+	if len(cfg.VirtualCenter) == 0 {
+		server := cfg.Global.VCenterIP
+		if server == "" {
+			server = cfg.Workspace.VCenterIP
+		}
+		vc := newVCenterConfig(cfg, server)
+		vc.Datacenters = addWorkspaceDatacenter(cfg, vc)
+		return []*VCenterConfig{vc}
+	}
+
+	for server, vcCfg := range cfg.VirtualCenter {
+		vc := newVCenterConfig(cfg, server)
+		if vcCfg != nil {
+			if vcCfg.VCenterPort != "" {
+				vc.Port = vcCfg.VCenterPort
+			}
+			if vcCfg.User != "" {
+				vc.User = vcCfg.User
+			}
+			if vcCfg.Password != "" {
+				vc.Password = vcCfg.Password
+			}
+			if vcCfg.Datacenters != "" {
+				vc.Datacenters = splitDatacenters(vcCfg.Datacenters)
+			}
+			if vcCfg.Thumbprint != "" {
+				vc.Thumbprint = vcCfg.Thumbprint
+			}
+		}
+		if extra := cfg.VirtualCenterExtra[server]; extra != nil {
+			vc.Insecure = vc.Insecure || extra.InsecureFlag
+			if extra.CAFile != "" {
+				vc.CAFile = extra.CAFile
+			}
+			if extra.SecretName != "" {
+				vc.SecretName = extra.SecretName
+				if extra.SecretNamespace != "" {
+					vc.SecretNamespace = extra.SecretNamespace
+				}
+			}
+		}
+		vc.Datacenters = addWorkspaceDatacenter(cfg, vc)
+		vcs = append(vcs, vc)
+	}
+	sort.Slice(vcs, func(i, j int) bool {
+		return vcs[i].Server < vcs[j].Server
+	})
+	return vcs
+}
+
+// newVCenterConfig returns config of the vCenter with all values from the Global section.
+func newVCenterConfig(cfg *Config, server string) *VCenterConfig {
+	return &VCenterConfig{
+		Server:          server,
+		Port:            cfg.Global.VCenterPort,
+		User:            cfg.Global.User,
+		Password:        cfg.Global.Password,
+		Insecure:        cfg.Global.InsecureFlag,
+		CAFile:          cfg.Global.CAFile,
+		Thumbprint:      cfg.Global.Thumbprint,
+		SecretName:      cfg.Global.SecretName,
+		SecretNamespace: cfg.Global.SecretNamespace,
+		Datacenters:     globalDatacenters(cfg),
+	}
+}
+
+// globalDatacenters returns datacenters from the Global section.
+func globalDatacenters(cfg *Config) []string {
+	if cfg.Global.Datacenters != "" {
+		return splitDatacenters(cfg.Global.Datacenters)
+	}
+	// Global.Datacenter is deprecated, so it has the lowest priority.
+	return splitDatacenters(cfg.Global.Datacenter)
+}
+
+// addWorkspaceDatacenter returns datacenters of the vCenter, including
+// Workspace.Datacenter when the vCenter is the Workspace one.
+func addWorkspaceDatacenter(cfg *Config, vc *VCenterConfig) []string {
+	dc := cfg.Workspace.Datacenter
+	if dc == "" || cfg.Workspace.VCenterIP != vc.Server {
+		return vc.Datacenters
+	}
+	for _, d := range vc.Datacenters {
+		if d == dc {
+			return vc.Datacenters
+		}
+	}
+	return append(vc.Datacenters, dc)
 }
 
-func NewClient(cfg *vsphere.VSphereConfig, username, password string) (*govmomi.Client, error) {
+func splitDatacenters(datacenters string) []string {
+	var dcs []string
+	for _, dc := range strings.Split(datacenters, ",") {
+		dc = strings.TrimSpace(dc)
+		if dc != "" {
+			dcs = append(dcs, dc)
+		}
+	}
+	return dcs
+}
 
-	serverAddress := cfg.Workspace.VCenterIP
+func NewClient(ctx context.Context, vc *VCenterConfig, username, password string) (*govmomi.Client, error) {
+	serverAddress := vc.Server
+	if serverAddress == "" {
+		return nil, fmt.Errorf("failed to parse config file: vCenter server address is empty")
+	}
 	serverURL, err := soap.ParseURL(serverAddress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %s", err)
 	}
+	if vc.Port != "" && serverURL.Port() == "" {
+		serverURL.Host = net.JoinHostPort(serverURL.Hostname(), vc.Port)
+	}
 	serverURL.User = url.UserPassword(username, password)
 
-	insecure := cfg.Global.InsecureFlag
-	ctx, cancel := context.WithTimeout(context.Background(), *Timeout)
+	insecure := vc.Insecure
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
 	defer cancel()
-	klog.V(4).Infof("Connecting to %s as %s, insecure %t", serverAddress, username, insecure)
+	klog.V(4).Infof("Connecting to %s as %s, insecure %t", serverURL.Host, username, insecure)
 
-	client, err := govmomi.NewClient(ctx, serverURL, insecure)
+	soapClient := soap.NewClient(serverURL, insecure)
+	if !insecure {
+		if vc.CAFile != "" {
+			if err := soapClient.SetRootCAs(vc.CAFile); err != nil {
+				return nil, fmt.Errorf("failed to load CA file %s: %s", vc.CAFile, err)
+			}
+		}
+		if vc.Thumbprint != "" {
+			soapClient.SetThumbprint(serverURL.Host, vc.Thumbprint)
+		}
+	}
+	vimClient, err := vim25.NewClient(ctx, soapClient)
 	if err != nil {
 		return nil, err
 	}
+	client := &govmomi.Client{
+		Client:         vimClient,
+		SessionManager: session.NewManager(vimClient),
+	}
+	if err := client.Login(ctx, serverURL.User); err != nil {
+		return nil, err
+	}
 	return client, nil
 }
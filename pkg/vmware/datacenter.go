@@ -0,0 +1,35 @@
+package vmware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+)
+
+// GetDatacenters returns all datacenters of the vCenter configured for the cluster.
+// When the config does not list any datacenter, all datacenters of the vCenter are returned.
+func GetDatacenters(ctx context.Context, vc *VCenter) ([]*object.Datacenter, error) {
+	ctx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+
+	finder := find.NewFinder(vc.Client.Client, false)
+	if len(vc.Config.Datacenters) == 0 {
+		dcs, err := finder.DatacenterList(ctx, "*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list datacenters in vCenter %s: %s", vc.Config.Server, err)
+		}
+		return dcs, nil
+	}
+
+	var dcs []*object.Datacenter
+	for _, name := range vc.Config.Datacenters {
+		dc, err := finder.Datacenter(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to access Datacenter %s in vCenter %s: %s", name, vc.Config.Server, err)
+		}
+		dcs = append(dcs, dc)
+	}
+	return dcs, nil
+}
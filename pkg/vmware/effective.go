@@ -0,0 +1,135 @@
+package vmware
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	defaultPort = "443"
+
+	CredentialsFromSecret = "Secret"
+	CredentialsFromConfig = "Config"
+)
+
+// EffectiveConfig is the vSphere config as used by the checks, with
+// precedence of Global, VirtualCenter and Workspace sections resolved.
+// It never contains passwords.
+type EffectiveConfig struct {
+	// Source describes where the config was read from.
+	Source string `json:"source,omitempty"`
+	// Format of the config.
+	Format        ConfigFormat       `json:"format,omitempty"`
+	VCenters      []EffectiveVCenter `json:"vCenters"`
+	Workspace     EffectiveWorkspace `json:"workspace"`
+	PublicNetwork string             `json:"publicNetwork,omitempty"`
+	Zone          string             `json:"zoneTagCategory,omitempty"`
+	Region        string             `json:"regionTagCategory,omitempty"`
+}
+
+// EffectiveVCenter is effective config of a single vCenter.
+type EffectiveVCenter struct {
+	Server string `json:"server"`
+	// Endpoint is URL of vCenter API.
+	Endpoint    string      `json:"endpoint"`
+	Insecure    bool        `json:"insecure"`
+	CAFile      string      `json:"caFile,omitempty"`
+	Thumbprint  string      `json:"thumbprint,omitempty"`
+	Datacenters []string    `json:"datacenters"`
+	Credentials Credentials `json:"credentials"`
+}
+
+// Credentials describes where credentials of a vCenter come from.
+type Credentials struct {
+	// Source is either CredentialsFromSecret or CredentialsFromConfig.
+	Source string `json:"source"`
+	// Secret is <namespace>/<name> of the Secret with the credentials.
+	Secret string `json:"secret,omitempty"`
+	// UsernameKey and PasswordKey are keys in the Secret or in the config.
+	UsernameKey string `json:"usernameKey"`
+	PasswordKey string `json:"passwordKey"`
+	// Username is the user name from the config. Values in the Secret are not read.
+	Username string `json:"username,omitempty"`
+	// Password is Redacted when the config has a password.
+	Password string `json:"password,omitempty"`
+}
+
+// EffectiveWorkspace is the vCenter location where volumes are created.
+type EffectiveWorkspace struct {
+	VCenter          string `json:"vCenter"`
+	Datacenter       string `json:"datacenter"`
+	Folder           string `json:"folder,omitempty"`
+	DefaultDatastore string `json:"defaultDatastore,omitempty"`
+	ResourcePoolPath string `json:"resourcePoolPath,omitempty"`
+}
+
+// GetEffectiveConfig returns the effective config of all vCenters.
+func GetEffectiveConfig(cfg *Config) *EffectiveConfig {
+	eff := &EffectiveConfig{
+		Workspace: EffectiveWorkspace{
+			VCenter:          cfg.Workspace.VCenterIP,
+			Datacenter:       cfg.Workspace.Datacenter,
+			Folder:           cfg.Workspace.Folder,
+			DefaultDatastore: cfg.Workspace.DefaultDatastore,
+			ResourcePoolPath: cfg.Workspace.ResourcePoolPath,
+		},
+		PublicNetwork: cfg.Network.PublicNetwork,
+		Zone:          cfg.Labels.Zone,
+		Region:        cfg.Labels.Region,
+	}
+	if eff.Workspace.DefaultDatastore == "" {
+		// Deprecated, used by the in-tree cloud provider as a fallback.
+		eff.Workspace.DefaultDatastore = cfg.Global.DefaultDatastore
+	}
+
+	for _, vc := range GetVCenters(cfg) {
+		port := vc.Port
+		if port == "" {
+			port = defaultPort
+		}
+		effVC := EffectiveVCenter{
+			Server:      vc.Server,
+			Endpoint:    fmt.Sprintf("https://%s/sdk", net.JoinHostPort(vc.Server, port)),
+			Insecure:    vc.Insecure,
+			CAFile:      vc.CAFile,
+			Thumbprint:  vc.Thumbprint,
+			Datacenters: vc.Datacenters,
+			Credentials: getCredentials(cfg, vc),
+		}
+		eff.VCenters = append(eff.VCenters, effVC)
+	}
+	return eff
+}
+
+// getCredentials returns source of credentials of the vCenter, as used by connect():
+// the Secret when the config has one, the config otherwise.
+func getCredentials(cfg *Config, vc *VCenterConfig) Credentials {
+	if vc.SecretName != "" {
+		return Credentials{
+			Source:      CredentialsFromSecret,
+			Secret:      vc.SecretNamespace + "/" + vc.SecretName,
+			UsernameKey: vc.Server + ".username",
+			PasswordKey: vc.Server + ".password",
+		}
+	}
+
+	creds := Credentials{
+		Source:      CredentialsFromConfig,
+		UsernameKey: "Global user",
+		PasswordKey: "Global password",
+		Username:    vc.User,
+	}
+	if vcCfg := cfg.VirtualCenter[vc.Server]; vcCfg != nil {
+		section := fmt.Sprintf("VirtualCenter %q", vc.Server)
+		if vcCfg.User != "" {
+			creds.UsernameKey = section + " user"
+		}
+		if vcCfg.Password != "" {
+			creds.PasswordKey = section + " password"
+		}
+	}
+	if vc.Password != "" {
+		creds.Password = Redacted
+	}
+	return creds
+}
@@ -0,0 +1,289 @@
+package vmware
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/gcfg.v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+	"k8s.io/legacy-cloud-providers/vsphere"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigFormat is a format of vSphere configuration file.
+type ConfigFormat string
+
+const (
+	// FormatInTree is INI config of the legacy in-tree cloud provider.
+	FormatInTree ConfigFormat = "in-tree"
+	// FormatCPIINI is INI config of the out-of-tree cloud-provider-vsphere.
+	FormatCPIINI ConfigFormat = "cpi-ini"
+	// FormatCPIYAML is YAML config of the out-of-tree cloud-provider-vsphere.
+	FormatCPIYAML ConfigFormat = "cpi-yaml"
+	// FormatCSI is csi-vsphere.conf of the vSphere CSI driver.
+	FormatCSI ConfigFormat = "csi"
+)
+
+// externalINIConfig is INI config of the out-of-tree cloud provider and of
+// the CSI driver. Both use the same sections, the CSI driver adds a few keys.
+type externalINIConfig struct {
+	Global struct {
+		User                string `gcfg:"user"`
+		Password            string `gcfg:"password"`
+		Server              string `gcfg:"server"`
+		Port                string `gcfg:"port"`
+		InsecureFlag        bool   `gcfg:"insecure-flag"`
+		CAFile              string `gcfg:"ca-file"`
+		Thumbprint          string `gcfg:"thumbprint"`
+		Datacenters         string `gcfg:"datacenters"`
+		RoundTripperCount   uint   `gcfg:"soap-roundtrip-count"`
+		SecretName          string `gcfg:"secret-name"`
+		SecretNamespace     string `gcfg:"secret-namespace"`
+		SecretsDirectory    string `gcfg:"secrets-directory"`
+		ClusterID           string `gcfg:"cluster-id"`
+		ClusterDistribution string `gcfg:"cluster-distribution"`
+	}
+	VirtualCenter map[string]*struct {
+		User              string `gcfg:"user"`
+		Password          string `gcfg:"password"`
+		TenantRef         string `gcfg:"tenantref"`
+		Port              string `gcfg:"port"`
+		InsecureFlag      bool   `gcfg:"insecure-flag"`
+		CAFile            string `gcfg:"ca-file"`
+		Thumbprint        string `gcfg:"thumbprint"`
+		Datacenters       string `gcfg:"datacenters"`
+		RoundTripperCount uint   `gcfg:"soap-roundtrip-count"`
+		SecretName        string `gcfg:"secret-name"`
+		SecretNamespace   string `gcfg:"secret-namespace"`
+	}
+	Labels struct {
+		Zone   string `gcfg:"zone"`
+		Region string `gcfg:"region"`
+	}
+}
+
+// cpiYAMLConfig is YAML config of the out-of-tree cloud provider.
+type cpiYAMLConfig struct {
+	Global struct {
+		User              string             `json:"user"`
+		Password          string             `json:"password"`
+		Server            string             `json:"server"`
+		Port              intstr.IntOrString `json:"port"`
+		InsecureFlag      bool               `json:"insecureFlag"`
+		CAFile            string             `json:"caFile"`
+		Thumbprint        string             `json:"thumbprint"`
+		Datacenters       []string           `json:"datacenters"`
+		RoundTripperCount uint               `json:"soapRoundtripCount"`
+		SecretName        string             `json:"secretName"`
+		SecretNamespace   string             `json:"secretNamespace"`
+		SecretsDirectory  string             `json:"secretsDirectory"`
+	} `json:"global"`
+	VCenter map[string]*cpiYAMLVCenter `json:"vcenter"`
+	Labels  struct {
+		Zone   string `json:"zone"`
+		Region string `json:"region"`
+	} `json:"labels"`
+}
+
+// cpiYAMLVCenter is a single vCenter in YAML config of the out-of-tree cloud provider.
+type cpiYAMLVCenter struct {
+	User              string             `json:"user"`
+	Password          string             `json:"password"`
+	Server            string             `json:"server"`
+	Port              intstr.IntOrString `json:"port"`
+	InsecureFlag      bool               `json:"insecureFlag"`
+	CAFile            string             `json:"caFile"`
+	Thumbprint        string             `json:"thumbprint"`
+	Datacenters       []string           `json:"datacenters"`
+	RoundTripperCount uint               `json:"soapRoundtripCount"`
+	SecretName        string             `json:"secretName"`
+	SecretNamespace   string             `json:"secretNamespace"`
+}
+
+// ParseConfigWithFormat parses vSphere config in any supported format and
+// returns it together with the detected format.
+//
+// Out-of-tree cloud provider and CSI driver configs are converted to the
+// in-tree model. They have no Workspace section, so Workspace.VCenterIP and
+// Workspace.Datacenter are set to the first vCenter and its first datacenter.
+// Per-vCenter TLS settings and secret references are kept in
+// Config.VirtualCenterExtra, because the in-tree model does not have them.
+func ParseConfigWithFormat(data string) (*Config, ConfigFormat, error) {
+	if !isINI(data) {
+		cfg, err := parseCPIYAML(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse YAML config: %s", err)
+		}
+		return cfg, FormatCPIYAML, nil
+	}
+
+	// The in-tree parser rejects keys it does not know, so it succeeds only
+	// on configs that it would read in the same way as the in-tree cloud provider.
+	var cfg Config
+	inTreeErr := gcfg.ReadStringInto(&cfg.VSphereConfig, data)
+	switch {
+	case inTreeErr != nil:
+		klog.V(4).Infof("Config is not in-tree config: %s", inTreeErr)
+	case cfg.Workspace.VCenterIP == "" && len(cfg.VirtualCenter) > 0:
+		// Out-of-tree configs that use only keys known to the in-tree
+		// parser have VirtualCenter sections, but no Workspace.
+		klog.V(4).Infof("Config has VirtualCenter sections and no Workspace server, reading it as out-of-tree config")
+	default:
+		return &cfg, FormatInTree, nil
+	}
+
+	var ext externalINIConfig
+	if err := gcfg.FatalOnly(gcfg.ReadStringInto(&ext, data)); err != nil {
+		return nil, "", fmt.Errorf("failed to parse INI config: %s", err)
+	}
+	format := FormatCPIINI
+	if ext.Global.ClusterID != "" {
+		format = FormatCSI
+	}
+	return convertExternalINI(&ext), format, nil
+}
+
+// isINI returns true when the first line that is not empty or a comment is an INI section.
+func isINI(data string) bool {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		return strings.HasPrefix(line, "[")
+	}
+	return false
+}
+
+func convertExternalINI(ext *externalINIConfig) *Config {
+	var cfg Config
+	cfg.Global.User = ext.Global.User
+	cfg.Global.Password = ext.Global.Password
+	cfg.Global.VCenterIP = ext.Global.Server
+	cfg.Global.VCenterPort = ext.Global.Port
+	cfg.Global.InsecureFlag = ext.Global.InsecureFlag
+	cfg.Global.CAFile = ext.Global.CAFile
+	cfg.Global.Thumbprint = ext.Global.Thumbprint
+	cfg.Global.Datacenters = ext.Global.Datacenters
+	cfg.Global.RoundTripperCount = ext.Global.RoundTripperCount
+	cfg.Global.SecretName = ext.Global.SecretName
+	cfg.Global.SecretNamespace = ext.Global.SecretNamespace
+	cfg.Labels.Zone = ext.Labels.Zone
+	cfg.Labels.Region = ext.Labels.Region
+
+	if len(ext.VirtualCenter) > 0 {
+		cfg.VirtualCenter = map[string]*vsphere.VirtualCenterConfig{}
+		cfg.VirtualCenterExtra = map[string]*VirtualCenterExtra{}
+	}
+	for server, vc := range ext.VirtualCenter {
+		vcCfg := &vsphere.VirtualCenterConfig{}
+		if vc != nil {
+			vcCfg.User = vc.User
+			vcCfg.Password = vc.Password
+			vcCfg.VCenterPort = vc.Port
+			vcCfg.Datacenters = vc.Datacenters
+			vcCfg.RoundTripperCount = vc.RoundTripperCount
+			vcCfg.Thumbprint = vc.Thumbprint
+			cfg.VirtualCenterExtra[server] = &VirtualCenterExtra{
+				InsecureFlag:    vc.InsecureFlag,
+				CAFile:          vc.CAFile,
+				SecretName:      vc.SecretName,
+				SecretNamespace: vc.SecretNamespace,
+			}
+		}
+		cfg.VirtualCenter[server] = vcCfg
+	}
+	setWorkspace(&cfg)
+	return &cfg
+}
+
+func parseCPIYAML(data string) (*Config, error) {
+	var y cpiYAMLConfig
+	if err := yaml.Unmarshal([]byte(data), &y); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	cfg.Global.User = y.Global.User
+	cfg.Global.Password = y.Global.Password
+	cfg.Global.VCenterIP = y.Global.Server
+	cfg.Global.VCenterPort = portString(y.Global.Port)
+	cfg.Global.InsecureFlag = y.Global.InsecureFlag
+	cfg.Global.CAFile = y.Global.CAFile
+	cfg.Global.Thumbprint = y.Global.Thumbprint
+	cfg.Global.Datacenters = strings.Join(y.Global.Datacenters, ",")
+	cfg.Global.RoundTripperCount = y.Global.RoundTripperCount
+	cfg.Global.SecretName = y.Global.SecretName
+	cfg.Global.SecretNamespace = y.Global.SecretNamespace
+	cfg.Labels.Zone = y.Labels.Zone
+	cfg.Labels.Region = y.Labels.Region
+
+	if len(y.VCenter) > 0 {
+		cfg.VirtualCenter = map[string]*vsphere.VirtualCenterConfig{}
+		cfg.VirtualCenterExtra = map[string]*VirtualCenterExtra{}
+	}
+	tenants := map[string]string{}
+	for _, name := range sortedTenants(y.VCenter) {
+		vc := y.VCenter[name]
+		// The map key is a tenant name, the vCenter address is in "server".
+		server := name
+		if vc != nil && vc.Server != "" {
+			server = vc.Server
+		}
+		if other, found := tenants[server]; found {
+			return nil, fmt.Errorf("vcenter %q and %q use the same server %q", other, name, server)
+		}
+		tenants[server] = name
+		if vc == nil {
+			cfg.VirtualCenter[server] = &vsphere.VirtualCenterConfig{}
+			continue
+		}
+		cfg.VirtualCenter[server] = &vsphere.VirtualCenterConfig{
+			User:              vc.User,
+			Password:          vc.Password,
+			VCenterPort:       portString(vc.Port),
+			Datacenters:       strings.Join(vc.Datacenters, ","),
+			RoundTripperCount: vc.RoundTripperCount,
+			Thumbprint:        vc.Thumbprint,
+		}
+		cfg.VirtualCenterExtra[server] = &VirtualCenterExtra{
+			InsecureFlag:    vc.InsecureFlag,
+			CAFile:          vc.CAFile,
+			SecretName:      vc.SecretName,
+			SecretNamespace: vc.SecretNamespace,
+		}
+	}
+	setWorkspace(&cfg)
+	return &cfg, nil
+}
+
+func portString(port intstr.IntOrString) string {
+	if port.Type == intstr.Int && port.IntVal == 0 {
+		return ""
+	}
+	return port.String()
+}
+
+// sortedTenants returns tenant names of all vCenters in YAML config.
+func sortedTenants(vCenters map[string]*cpiYAMLVCenter) []string {
+	var names []string
+	for name := range vCenters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setWorkspace fills the Workspace section from the first vCenter and its first datacenter.
+func setWorkspace(cfg *Config) {
+	vcs := GetVCenters(cfg)
+	if len(vcs) == 0 {
+		return
+	}
+	cfg.Workspace.VCenterIP = vcs[0].Server
+	if len(vcs[0].Datacenters) > 0 {
+		cfg.Workspace.Datacenter = vcs[0].Datacenters[0]
+	}
+}
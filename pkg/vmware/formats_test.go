@@ -0,0 +1,184 @@
+package vmware
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigPerVCenterSettings(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         string
+		expectedFormat ConfigFormat
+		expected       []*VCenterConfig
+		// expectedWorkspace is Workspace server and datacenter, checked when set.
+		expectedWorkspace []string
+		expectError       bool
+	}{
+		{
+			name: "CPI INI with per-vCenter TLS and secrets",
+			config: `
+[Global]
+secret-name = "global-creds"
+secret-namespace = "kube-system"
+ca-file = "/etc/ssl/global.pem"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+insecure-flag = true
+
+[VirtualCenter "vc2.example.com"]
+datacenters = "dc2"
+ca-file = "/etc/ssl/vc2.pem"
+secret-name = "vc2-creds"
+`,
+			expectedFormat: FormatCPIINI,
+			expected: []*VCenterConfig{
+				{
+					Server:          "vc1.example.com",
+					Insecure:        true,
+					CAFile:          "/etc/ssl/global.pem",
+					SecretName:      "global-creds",
+					SecretNamespace: "kube-system",
+					Datacenters:     []string{"dc1"},
+				},
+				{
+					Server:          "vc2.example.com",
+					CAFile:          "/etc/ssl/vc2.pem",
+					SecretName:      "vc2-creds",
+					SecretNamespace: "kube-system",
+					Datacenters:     []string{"dc2"},
+				},
+			},
+		},
+		{
+			name: "CPI INI with only keys known to the in-tree parser",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+insecure-flag = "1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1,dc2"
+`,
+			expectedFormat: FormatCPIINI,
+			expected: []*VCenterConfig{
+				{
+					Server:          "vc1.example.com",
+					Insecure:        true,
+					SecretName:      "vsphere-creds",
+					SecretNamespace: "kube-system",
+					Datacenters:     []string{"dc1", "dc2"},
+				},
+			},
+			expectedWorkspace: []string{"vc1.example.com", "dc1"},
+		},
+		{
+			name: "in-tree INI with Workspace",
+			config: `
+[Global]
+secret-name = "vsphere-creds"
+secret-namespace = "kube-system"
+
+[Workspace]
+server = "vc1.example.com"
+datacenter = "dc1"
+default-datastore = "ds1"
+
+[VirtualCenter "vc1.example.com"]
+datacenters = "dc1"
+`,
+			expectedFormat: FormatInTree,
+			expected: []*VCenterConfig{
+				{
+					Server:          "vc1.example.com",
+					SecretName:      "vsphere-creds",
+					SecretNamespace: "kube-system",
+					Datacenters:     []string{"dc1"},
+				},
+			},
+			expectedWorkspace: []string{"vc1.example.com", "dc1"},
+		},
+		{
+			name: "CPI YAML with per-vCenter TLS and secrets",
+			config: `
+global:
+  secretName: global-creds
+  secretNamespace: kube-system
+vcenter:
+  tenant1:
+    server: vc1.example.com
+    datacenters: [dc1]
+    insecureFlag: true
+  tenant2:
+    server: vc2.example.com
+    datacenters: [dc2]
+    caFile: /etc/ssl/vc2.pem
+    thumbprint: "AA:BB"
+    secretName: vc2-creds
+    secretNamespace: vc2-ns
+`,
+			expectedFormat: FormatCPIYAML,
+			expected: []*VCenterConfig{
+				{
+					Server:          "vc1.example.com",
+					Insecure:        true,
+					SecretName:      "global-creds",
+					SecretNamespace: "kube-system",
+					Datacenters:     []string{"dc1"},
+				},
+				{
+					Server:          "vc2.example.com",
+					CAFile:          "/etc/ssl/vc2.pem",
+					Thumbprint:      "AA:BB",
+					SecretName:      "vc2-creds",
+					SecretNamespace: "vc2-ns",
+					Datacenters:     []string{"dc2"},
+				},
+			},
+		},
+		{
+			name: "CPI YAML with two tenants of the same server",
+			config: `
+vcenter:
+  tenant1:
+    server: vc1.example.com
+  tenant2:
+    server: vc1.example.com
+`,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, format, err := ParseConfigWithFormat(test.config)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if format != test.expectedFormat {
+				t.Errorf("expected format %s, got %s", test.expectedFormat, format)
+			}
+			vcs := GetVCenters(cfg)
+			if !reflect.DeepEqual(vcs, test.expected) {
+				for _, vc := range vcs {
+					t.Logf("got %+v", vc)
+				}
+				t.Errorf("unexpected vCenters")
+			}
+			if test.expectedWorkspace != nil {
+				workspace := []string{cfg.Workspace.VCenterIP, cfg.Workspace.Datacenter}
+				if !reflect.DeepEqual(workspace, test.expectedWorkspace) {
+					t.Errorf("expected Workspace %v, got %v", test.expectedWorkspace, workspace)
+				}
+			}
+		})
+	}
+}
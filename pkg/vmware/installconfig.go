@@ -0,0 +1,94 @@
+package vmware
+
+import (
+	"fmt"
+
+	"k8s.io/legacy-cloud-providers/vsphere"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// maxClusterNameLength is the maximum length of the cluster name used
+	// by the OpenShift installer in the cluster ID.
+	maxClusterNameLength = 27
+	// syntheticIDSuffix has the same length as the random suffix of the
+	// cluster ID generated by the OpenShift installer.
+	syntheticIDSuffix = "xxxxx"
+)
+
+// InstallConfig is the subset of OpenShift install-config.yaml that is
+// relevant to vSphere.
+type InstallConfig struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Platform struct {
+		VSphere *InstallConfigVSphere `json:"vsphere"`
+	} `json:"platform"`
+}
+
+// InstallConfigVSphere is platform.vsphere section of install-config.yaml.
+type InstallConfigVSphere struct {
+	VCenter          string `json:"vCenter"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	Datacenter       string `json:"datacenter"`
+	DefaultDatastore string `json:"defaultDatastore"`
+	Cluster          string `json:"cluster"`
+	Network          string `json:"network"`
+	Folder           string `json:"folder"`
+	ResourcePool     string `json:"resourcePool"`
+}
+
+// ParseInstallConfig parses OpenShift install-config.yaml.
+func ParseInstallConfig(data []byte) (*InstallConfig, error) {
+	var ic InstallConfig
+	if err := yaml.Unmarshal(data, &ic); err != nil {
+		return nil, err
+	}
+	if ic.Platform.VSphere == nil {
+		return nil, fmt.Errorf("install config does not contain platform.vsphere")
+	}
+	if ic.Platform.VSphere.VCenter == "" {
+		return nil, fmt.Errorf("install config does not contain platform.vsphere.vCenter")
+	}
+	return &ic, nil
+}
+
+// VSphereConfig returns cloud provider config equivalent to the one the
+// OpenShift installer would create from the install config. The vCenter
+// credentials are stored directly in the config.
+func (ic *InstallConfig) VSphereConfig() *Config {
+	p := ic.Platform.VSphere
+	var cfg Config
+	cfg.Global.User = p.Username
+	cfg.Global.Password = p.Password
+	cfg.VirtualCenter = map[string]*vsphere.VirtualCenterConfig{
+		p.VCenter: {
+			Datacenters: p.Datacenter,
+		},
+	}
+	cfg.Workspace.VCenterIP = p.VCenter
+	cfg.Workspace.Datacenter = p.Datacenter
+	cfg.Workspace.DefaultDatastore = p.DefaultDatastore
+	cfg.Workspace.Folder = p.Folder
+	cfg.Workspace.ResourcePoolPath = p.ResourcePool
+	if cfg.Workspace.ResourcePoolPath == "" && p.Cluster != "" {
+		cfg.Workspace.ResourcePoolPath = fmt.Sprintf("/%s/host/%s/Resources", p.Datacenter, p.Cluster)
+	}
+	cfg.Network.PublicNetwork = p.Network
+	return &cfg
+}
+
+// ClusterID returns a synthetic cluster ID with the same length as the ID
+// the OpenShift installer would generate.
+func (ic *InstallConfig) ClusterID() string {
+	name := ic.Metadata.Name
+	if name == "" {
+		name = "cluster"
+	}
+	if len(name) > maxClusterNameLength {
+		name = name[:maxClusterNameLength]
+	}
+	return name + "-" + syntheticIDSuffix
+}
@@ -0,0 +1,280 @@
+package vmware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"k8s.io/klog/v2"
+)
+
+// Inventory is a snapshot of vSphere objects in all configured datacenters
+// of all vCenters. It is loaded once per run and shared by all checks.
+// It contains only plain data, so it can be saved to disk.
+type Inventory struct {
+	Datacenters []*InventoryDatacenter `json:"datacenters"`
+}
+
+// InventoryObject is a single vSphere managed entity.
+type InventoryObject struct {
+	Name string                       `json:"name"`
+	Ref  types.ManagedObjectReference `json:"ref"`
+}
+
+// InventoryDatacenter is a datacenter with all its objects.
+type InventoryDatacenter struct {
+	InventoryObject
+	// Path is inventory path of the datacenter, e.g. "/folder/DC".
+	Path string `json:"path,omitempty"`
+	// VCenter is server of the vCenter, as in the config.
+	VCenter     string                `json:"vCenter"`
+	Clusters    []InventoryObject     `json:"clusters,omitempty"`
+	Hosts       []InventoryHost       `json:"hosts,omitempty"`
+	Datastores  []InventoryDatastore  `json:"datastores,omitempty"`
+	StoragePods []InventoryStoragePod `json:"storagePods,omitempty"`
+	Networks    []InventoryObject     `json:"networks,omitempty"`
+	VMs         []InventoryVM         `json:"vms,omitempty"`
+}
+
+// InventoryHost is an ESXi host.
+type InventoryHost struct {
+	InventoryObject
+	// Parent is the cluster or compute resource of the host.
+	Parent *types.ManagedObjectReference `json:"parent,omitempty"`
+}
+
+// InventoryDatastore is a datastore.
+type InventoryDatastore struct {
+	InventoryObject
+	URL  string `json:"url,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// InventoryStoragePod is a datastore cluster.
+type InventoryStoragePod struct {
+	InventoryObject
+	Datastores []types.ManagedObjectReference `json:"datastores,omitempty"`
+}
+
+// InventoryVM is a virtual machine. Fields are empty when the VM has no
+// config or guest info, e.g. when it is inaccessible.
+type InventoryVM struct {
+	InventoryObject
+	BIOSUUID        string `json:"biosUUID,omitempty"`
+	InstanceUUID    string `json:"instanceUUID,omitempty"`
+	DiskUUIDEnabled *bool  `json:"diskUUIDEnabled,omitempty"`
+	// HardwareVersion is the virtual hardware version, e.g. "vmx-15".
+	HardwareVersion string `json:"hardwareVersion,omitempty"`
+	// ToolsRunningStatus and ToolsVersionStatus are status of VMware Tools
+	// in the guest, e.g. "guestToolsRunning" and "guestToolsCurrent".
+	ToolsRunningStatus string `json:"toolsRunningStatus,omitempty"`
+	ToolsVersionStatus string `json:"toolsVersionStatus,omitempty"`
+	// GuestHostName is the hostname of the guest OS, as reported by VMware Tools.
+	GuestHostName string `json:"guestHostName,omitempty"`
+	// GuestIPAddresses are IP addresses of all guest NICs, as reported by VMware Tools.
+	GuestIPAddresses []string `json:"guestIPAddresses,omitempty"`
+}
+
+func (d *InventoryDatacenter) String() string {
+	return fmt.Sprintf("%s/%s", d.VCenter, d.Name)
+}
+
+// InventoryPath returns inventory path of the datacenter. Inventories saved
+// without the path have only datacenters in the root folder.
+func (d *InventoryDatacenter) InventoryPath() string {
+	if d.Path != "" {
+		return d.Path
+	}
+	return "/" + d.Name
+}
+
+// DatastorePath returns inventory path of a datastore given by its name or
+// path relative to the datastore folder of the datacenter, as in the config.
+func (d *InventoryDatacenter) DatastorePath(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	return path.Join(d.InventoryPath(), "datastore", name)
+}
+
+// GetDatacenters returns all datacenters of the vCenter in the inventory.
+func (inv *Inventory) GetDatacenters(server string) []*InventoryDatacenter {
+	var dcs []*InventoryDatacenter
+	for _, dc := range inv.Datacenters {
+		if dc.VCenter == server {
+			dcs = append(dcs, dc)
+		}
+	}
+	return dcs
+}
+
+// GetDatacenter returns datacenter with given name in the vCenter or nil when it's not in the inventory.
+func (inv *Inventory) GetDatacenter(server, name string) *InventoryDatacenter {
+	for _, dc := range inv.GetDatacenters(server) {
+		if dc.Name == name || strings.TrimPrefix(name, "/") == dc.Name {
+			return dc
+		}
+	}
+	return nil
+}
+
+// LoadInventory loads objects of all configured datacenters of all vCenters.
+// It makes one container view and one property retrieval per object type
+// in each datacenter.
+func LoadInventory(ctx context.Context, vCenters []*VCenter) (*Inventory, error) {
+	inv := &Inventory{}
+	for _, vc := range vCenters {
+		dcs, err := GetDatacenters(ctx, vc)
+		if err != nil {
+			return nil, err
+		}
+		for _, dc := range dcs {
+			invDC, err := loadDatacenter(ctx, vc, dc)
+			if err != nil {
+				return nil, err
+			}
+			inv.Datacenters = append(inv.Datacenters, invDC)
+		}
+	}
+	return inv, nil
+}
+
+func loadDatacenter(ctx context.Context, vc *VCenter, dc *object.Datacenter) (*InventoryDatacenter, error) {
+	invDC := &InventoryDatacenter{
+		InventoryObject: InventoryObject{Name: dc.Name(), Ref: dc.Reference()},
+		Path:            dc.InventoryPath,
+		VCenter:         vc.Config.Server,
+	}
+
+	viewCtx, cancel := context.WithTimeout(ctx, *Timeout)
+	defer cancel()
+	m := view.NewManager(vc.Client.Client)
+	kinds := []string{"ClusterComputeResource", "HostSystem", "Datastore", "StoragePod", "Network", "VirtualMachine"}
+	v, err := m.CreateContainerView(viewCtx, dc.Reference(), kinds, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create view of %s: %s", invDC.String(), err)
+	}
+	defer v.Destroy(ctx)
+
+	retrieve := func(kind string, props []string, dst interface{}) error {
+		ctx, cancel := context.WithTimeout(ctx, *Timeout)
+		defer cancel()
+		if err := v.Retrieve(ctx, []string{kind}, props, dst); err != nil {
+			return fmt.Errorf("failed to load %s objects in %s: %s", kind, invDC.String(), err)
+		}
+		return nil
+	}
+
+	var clusters []mo.ClusterComputeResource
+	if err := retrieve("ClusterComputeResource", []string{"name"}, &clusters); err != nil {
+		return nil, err
+	}
+	for i := range clusters {
+		invDC.Clusters = append(invDC.Clusters, InventoryObject{Name: clusters[i].Name, Ref: clusters[i].Self})
+	}
+
+	var hosts []mo.HostSystem
+	if err := retrieve("HostSystem", []string{"name", "parent"}, &hosts); err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		invDC.Hosts = append(invDC.Hosts, InventoryHost{
+			InventoryObject: InventoryObject{Name: hosts[i].Name, Ref: hosts[i].Self},
+			Parent:          hosts[i].Parent,
+		})
+	}
+
+	var datastores []mo.Datastore
+	if err := retrieve("Datastore", []string{"name", "summary.url", "summary.type"}, &datastores); err != nil {
+		return nil, err
+	}
+	for i := range datastores {
+		invDC.Datastores = append(invDC.Datastores, InventoryDatastore{
+			InventoryObject: InventoryObject{Name: datastores[i].Name, Ref: datastores[i].Self},
+			URL:             datastores[i].Summary.Url,
+			Type:            datastores[i].Summary.Type,
+		})
+	}
+
+	var pods []mo.StoragePod
+	if err := retrieve("StoragePod", []string{"name", "childEntity"}, &pods); err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		invDC.StoragePods = append(invDC.StoragePods, InventoryStoragePod{
+			InventoryObject: InventoryObject{Name: pods[i].Name, Ref: pods[i].Self},
+			Datastores:      pods[i].ChildEntity,
+		})
+	}
+
+	// Includes distributed port groups and opaque networks.
+	var networks []mo.Network
+	if err := retrieve("Network", []string{"name"}, &networks); err != nil {
+		return nil, err
+	}
+	for i := range networks {
+		invDC.Networks = append(invDC.Networks, InventoryObject{Name: networks[i].Name, Ref: networks[i].Self})
+	}
+
+	var vms []mo.VirtualMachine
+	vmProps := []string{
+		"name", "config.uuid", "config.instanceUuid", "config.flags", "config.version",
+		"guest.toolsRunningStatus", "guest.toolsVersionStatus2", "guest.hostName", "guest.net",
+	}
+	if err := retrieve("VirtualMachine", vmProps, &vms); err != nil {
+		return nil, err
+	}
+	for i := range vms {
+		vm := InventoryVM{
+			InventoryObject: InventoryObject{Name: vms[i].Name, Ref: vms[i].Self},
+		}
+		if cfg := vms[i].Config; cfg != nil {
+			vm.BIOSUUID = strings.ToLower(cfg.Uuid)
+			vm.InstanceUUID = strings.ToLower(cfg.InstanceUuid)
+			vm.DiskUUIDEnabled = cfg.Flags.DiskUuidEnabled
+			vm.HardwareVersion = cfg.Version
+		}
+		if guest := vms[i].Guest; guest != nil {
+			vm.ToolsRunningStatus = guest.ToolsRunningStatus
+			vm.ToolsVersionStatus = guest.ToolsVersionStatus2
+			vm.GuestHostName = guest.HostName
+			for _, nic := range guest.Net {
+				vm.GuestIPAddresses = append(vm.GuestIPAddresses, nic.IpAddress...)
+			}
+		}
+		invDC.VMs = append(invDC.VMs, vm)
+	}
+
+	klog.V(4).Infof("Loaded inventory of %s: %d clusters, %d hosts, %d datastores, %d storage pods, %d networks, %d VMs",
+		invDC.String(), len(invDC.Clusters), len(invDC.Hosts), len(invDC.Datastores), len(invDC.StoragePods), len(invDC.Networks), len(invDC.VMs))
+	return invDC, nil
+}
+
+// Save writes the inventory as JSON to a file.
+func (inv *Inventory) Save(path string) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadInventory reads inventory saved by Save.
+func ReadInventory(path string) (*Inventory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{}
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	return inv, nil
+}
@@ -0,0 +1,108 @@
+package vmware
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestInventorySaveRead(t *testing.T) {
+	enabled := true
+	ref := func(kind, value string) types.ManagedObjectReference {
+		return types.ManagedObjectReference{Type: kind, Value: value}
+	}
+	inv := &Inventory{
+		Datacenters: []*InventoryDatacenter{
+			{
+				InventoryObject: InventoryObject{Name: "DC0", Ref: ref("Datacenter", "datacenter-2")},
+				Path:            "/DC0",
+				VCenter:         "vcenter.example.com",
+				Hosts: []InventoryHost{
+					{
+						InventoryObject: InventoryObject{Name: "host-0", Ref: ref("HostSystem", "host-21")},
+						Parent:          &types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c7"},
+					},
+				},
+				Datastores: []InventoryDatastore{
+					{
+						InventoryObject: InventoryObject{Name: "LocalDS_0", Ref: ref("Datastore", "datastore-14")},
+						URL:             "ds:///vmfs/volumes/LocalDS_0/",
+						Type:            "VMFS",
+					},
+				},
+				VMs: []InventoryVM{
+					{
+						InventoryObject:  InventoryObject{Name: "node-0", Ref: ref("VirtualMachine", "vm-42")},
+						BIOSUUID:         "42011d7a-0f1c-4c6a-9f2e-3c6b1f0c2a10",
+						DiskUUIDEnabled:  &enabled,
+						HardwareVersion:  "vmx-15",
+						GuestIPAddresses: []string{"10.0.0.10"},
+					},
+				},
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := inv.Save(path); err != nil {
+		t.Fatalf("failed to save inventory: %s", err)
+	}
+	read, err := ReadInventory(path)
+	if err != nil {
+		t.Fatalf("failed to read inventory: %s", err)
+	}
+	if !reflect.DeepEqual(inv, read) {
+		t.Errorf("read inventory differs from the saved one:\nexpected %+v\ngot      %+v", inv.Datacenters[0], read.Datacenters[0])
+	}
+}
+
+func TestDatastorePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		dc         *InventoryDatacenter
+		datastore  string
+		expectPath string
+	}{
+		{
+			name:       "datastore name",
+			dc:         &InventoryDatacenter{InventoryObject: InventoryObject{Name: "DC0"}, Path: "/DC0"},
+			datastore:  "ds1",
+			expectPath: "/DC0/datastore/ds1",
+		},
+		{
+			name:       "datacenter in a folder",
+			dc:         &InventoryDatacenter{InventoryObject: InventoryObject{Name: "DC0"}, Path: "/folder/DC0"},
+			datastore:  "ds1",
+			expectPath: "/folder/DC0/datastore/ds1",
+		},
+		{
+			name:       "path relative to the datastore folder",
+			dc:         &InventoryDatacenter{InventoryObject: InventoryObject{Name: "DC0"}, Path: "/DC0"},
+			datastore:  "sub/ds1",
+			expectPath: "/DC0/datastore/sub/ds1",
+		},
+		{
+			name:       "absolute path",
+			dc:         &InventoryDatacenter{InventoryObject: InventoryObject{Name: "DC0"}, Path: "/DC0"},
+			datastore:  "/DC0/datastore/ds1",
+			expectPath: "/DC0/datastore/ds1",
+		},
+		{
+			name:       "inventory saved without datacenter path",
+			dc:         &InventoryDatacenter{InventoryObject: InventoryObject{Name: "DC0"}},
+			datastore:  "ds1",
+			expectPath: "/DC0/datastore/ds1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := test.dc.DatastorePath(test.datastore)
+			if path != test.expectPath {
+				t.Errorf("expected %q, got %q", test.expectPath, path)
+			}
+		})
+	}
+}
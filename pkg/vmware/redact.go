@@ -0,0 +1,19 @@
+package vmware
+
+import (
+	"regexp"
+)
+
+// Redacted replaces secret values in logs and in printed config.
+const Redacted = "REDACTED"
+
+// secretLineRe matches INI and YAML lines with a password or a token,
+// e.g. `password = "secret"` or `  sessionToken: abc`.
+var secretLineRe = regexp.MustCompile(`(?im)^(\s*[\w.-]*(?:password|token)[\w.-]*\s*[=:]).*$`)
+
+// RedactConfig returns vSphere config (in any supported format) with values
+// of all passwords and tokens replaced, so it can be logged. It covers only
+// config dumps, other log messages must not contain secrets at all.
+func RedactConfig(data string) string {
+	return secretLineRe.ReplaceAllString(data, "${1} "+Redacted)
+}
@@ -0,0 +1,87 @@
+package vmware
+
+import (
+	"testing"
+)
+
+func TestRedactConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			name: "quoted INI values",
+			config: `[Global]
+user = "admin"
+password = "se=cr:et"
+`,
+			expected: `[Global]
+user = "admin"
+password = REDACTED
+`,
+		},
+		{
+			name: "unquoted INI values",
+			config: `[VirtualCenter "vc1.example.com"]
+password=secret
+datacenters=dc1
+`,
+			expected: `[VirtualCenter "vc1.example.com"]
+password= REDACTED
+datacenters=dc1
+`,
+		},
+		{
+			name: "CPI YAML",
+			config: `global:
+  user: admin
+  password: secret
+vcenter:
+  tenant1:
+    server: vc1.example.com
+    password: "other secret"
+`,
+			expected: `global:
+  user: admin
+  password: REDACTED
+vcenter:
+  tenant1:
+    server: vc1.example.com
+    password: REDACTED
+`,
+		},
+		{
+			name: "mixed-case keys",
+			config: `[Global]
+Password = "secret"
+vc1.example.com.PASSWORD = secret
+sessionToken = abc
+`,
+			expected: `[Global]
+Password = REDACTED
+vc1.example.com.PASSWORD = REDACTED
+sessionToken = REDACTED
+`,
+		},
+		{
+			name:     "indented INI lines",
+			config:   "[Global]\n\t  password = \"secret\"\n  server = vc1.example.com\n",
+			expected: "[Global]\n\t  password = REDACTED\n  server = vc1.example.com\n",
+		},
+		{
+			name:     "secret-name is not redacted",
+			config:   "[Global]\nsecret-name = \"vsphere-creds\"\n",
+			expected: "[Global]\nsecret-name = \"vsphere-creds\"\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redacted := RedactConfig(test.config)
+			if redacted != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, redacted)
+			}
+		})
+	}
+}